@@ -1,29 +1,95 @@
 package boxer
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"image/color"
 	"io"
+	"io/ioutil"
 	"log"
 	"math"
+	"net"
 	"os"
 	"os/exec"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
+// DefaultTickInterval is the default expected time between ticks.
+const DefaultTickInterval = 1 * time.Second
+
 // Ticker represents an object that can check for new time intervals and perform actions.
 // The ticker is not safe to use in multiple goroutines.
 type Ticker struct {
-	prev time.Time // last tick time
+	prev     time.Time    // last tick time
+	prevEnd  time.Time    // time the last tick finished executing
+	rebase   time.Time    // reference time used after waking from sleep
+	prevs    []time.Time  // last time each command was checked
+	captured []Restorable // restorables with captured state
+	closed   bool         // true after Close() is called
+
+	mu         sync.Mutex       // protects lastErrors
+	lastErrors map[string]error // result of each command's last execution
+
+	completed    map[string]int // intervals completed today by command name
+	completedDay time.Time      // midnight of the day counted by completed
+	summary      Summary        // intervals completed on the previous day
+
+	intervals      map[string]int       // index of each command's current interval
+	intervalStarts map[string]time.Time // start of each command's current interval
 
 	// A list of commands to execute when steps occur.
 	Commands []Command
 
+	// The reference time that steps and intervals are aligned to.
+	// If zero, steps and intervals are aligned to the zero time.
+	Anchor time.Time
+
+	// If the time between the end of one tick and the start of the next
+	// exceeds this threshold, such as after the machine wakes from sleep,
+	// steps and intervals are realigned to the current time so that a new
+	// interval begins. The Anchor field is left unchanged. Disabled if zero.
+	SleepThreshold time.Duration
+
+	// The expected time between ticks. Used as the tolerance when checking
+	// whether a time is on an interval boundary.
+	TickInterval time.Duration
+
 	// The logger used for displaying debug information.
 	Logger *log.Logger
 
+	// If true, the duration of every handler execution is logged.
+	Verbose bool
+
+	// Optional tracer used to record spans around ticks and handler execution.
+	// Handler spans are started as children of the span of their tick.
+	Tracer Tracer
+
+	// Optional function called at the start of every tick before any handler
+	// executes, such as to reset state shared by handlers within a tick.
+	OnTick func(now time.Time)
+
+	// Optional function called with the result of every handler execution.
+	// If set, handler errors are reported here instead of to the logger.
+	OnResult ResultFunc
+
+	// Optional counters for ticks, completed intervals & handler errors.
+	Metrics Metrics
+
+	// If true, handlers that are due on the same tick are executed in
+	// parallel. The tick waits for all handlers to complete.
+	Concurrent bool
+
+	// Optional schedule outside of which handlers are not executed.
+	Schedule *Schedule
+
 	// A function used to return the current time.
 	// This is used for testing.
 	Now NowFunc
@@ -32,46 +98,601 @@ type Ticker struct {
 // NewTicker returns a new instance of Ticker with default settings.
 func NewTicker() *Ticker {
 	return &Ticker{
-		Logger: log.New(os.Stderr, "", 0),
-		Now:    time.Now,
+		TickInterval: DefaultTickInterval,
+		Logger:       log.New(os.Stderr, "", 0),
+		Now:          time.Now,
 	}
 }
 
 // Tick checks the current time to see if a new segment or interval has occurred.
-func (t *Ticker) Tick() {
-	// Retrieve the current time.
-	now := t.Now()
+// Errors returned by handlers are returned prefixed with the command name. They
+// are also logged unless OnResult is set, in which case they are only reported
+// to OnResult.
+func (t *Ticker) Tick() []error {
+	return t.TickAt(t.Now())
+}
+
+// TickFrom ticks once for every time received on ch, using it as the current time.
+// It returns when ch is closed.
+func (t *Ticker) TickFrom(ch <-chan time.Time) {
+	for now := range ch {
+		t.TickAt(now)
+	}
+}
+
+// TickAt checks now to see if a new segment or interval has occurred.
+// This is the same as Tick except that the Now function is not used.
+func (t *Ticker) TickAt(now time.Time) []error {
+	start := time.Now()
+	span := t.startSpan("tick", nil)
+	defer span.End(nil)
+
+	if t.Metrics != nil {
+		t.Metrics.IncTicks()
+	}
+	if t.OnTick != nil {
+		t.OnTick(now)
+	}
+
+	// Summarize the previous day's intervals once the date changes.
+	t.rollover(now)
+
+	// Skip execution outside of the schedule. Steps that begin while inactive
+	// execute on the first tick after the schedule becomes active again.
+	if t.Schedule != nil && !t.Schedule.Active(now) {
+		t.prev, t.prevEnd = now, now
+		return nil
+	}
+
+	// Restart intervals from now if too much time has passed since the last
+	// tick finished. Handler run time is not counted against the threshold.
+	if t.SleepThreshold > 0 && !t.prevEnd.IsZero() && now.Sub(t.prevEnd) > t.SleepThreshold {
+		t.rebase = now
+	}
+
+	// Reset the per-command check times if the commands have changed.
+	if len(t.prevs) != len(t.Commands) {
+		t.prevs = make([]time.Time, len(t.Commands))
+	}
+
+	// Determine which commands have entered a new step.
+	var steps []step
+	for j, cmd := range t.Commands {
+		// Skip the command if it was checked too recently.
+		prev := t.prevs[j]
+		if cmd.MinTickInterval > 0 && !prev.IsZero() && now.Sub(prev) < cmd.MinTickInterval {
+			continue
+		}
+		t.prevs[j] = now
 
-	// Iterate over each command.
-	for _, cmd := range t.Commands {
 		// Initialize step to the interval if there is no step.
-		step, interval := cmd.Step, cmd.Interval
-		if step == 0 {
-			step = cmd.Interval
+		stepDur, interval := cmd.Step, cmd.Interval
+		if stepDur == 0 {
+			stepDur = cmd.Interval
+		}
+
+		// Shift the times back by the offset so the command's steps begin
+		// after the step boundaries.
+		cur := now.Add(-cmd.Offset)
+		if !prev.IsZero() {
+			prev = prev.Add(-cmd.Offset)
 		}
 
 		// Check if we've entered a new step within the interval.
-		if t.prev.Truncate(step) != now.Truncate(step) && cmd.Handler != nil {
+		if t.truncate(prev, stepDur) != t.truncate(cur, stepDur) && cmd.Handler != nil {
 			// Calculate the current step number & total steps.
-			var i, n int
-			if step == 0 {
-				i, n = 0, 1
-			} else {
-				i = int(now.Truncate(step).Sub(now.Truncate(interval)) / step)
-				n = int(interval / step)
+			i, n := t.position(cur, stepDur, interval)
+
+			// Advance the interval index when a new interval begins.
+			t.enterInterval(cmd.Name, t.truncate(cur, interval))
+
+			// Count the interval as completed once its final step is reached.
+			if i == n-1 {
+				t.incCompleted(cmd.Name, now)
 			}
 
-			// Execute the command's handler.
-			if err := cmd.Handler(i, n); err != nil {
-				t.Logger.Printf("%s: %s", cmd.Name, err.Error())
+			// Capture the original system state before the first execution.
+			if err := t.capture(cmd.Restorable); err != nil {
+				t.Logger.Printf("%s: capture: %s", cmd.Name, err.Error())
 			}
+
+			steps = append(steps, step{cmd: cmd, i: i, n: n})
 		}
 	}
 
-	// Set the previous tick time for the next run.
+	// Execute each command's handler.
+	errs := make([]error, len(steps))
+	if t.Concurrent {
+		var wg sync.WaitGroup
+		for j := range steps {
+			wg.Add(1)
+			go func(j int) {
+				defer wg.Done()
+				errs[j] = t.execute(span, steps[j])
+			}(j)
+		}
+		wg.Wait()
+	} else {
+		for j := range steps {
+			errs[j] = t.execute(span, steps[j])
+		}
+	}
+
+	// Set the previous tick time for the next run. The end time includes
+	// however long the handlers took to execute.
 	t.prev = now
+	t.prevEnd = now.Add(time.Since(start))
+
+	// Remove successful executions from the errors.
+	a := errs[:0]
+	for _, err := range errs {
+		if err != nil {
+			a = append(a, err)
+		}
+	}
+	if len(a) == 0 {
+		return nil
+	}
+	return a
+}
+
+// execute runs the handler for a single step of a command within the tick
+// recorded by parent. Returns the handler's error prefixed with the command name.
+func (t *Ticker) execute(parent Span, s step) error {
+	span := parent.StartSpan("handler", map[string]interface{}{
+		"command": s.cmd.Name,
+		"step":    s.i,
+		"total":   s.n,
+		"pct":     float64(s.i) / float64(s.n),
+	})
+	start := time.Now()
+	err := s.cmd.Handler(s.i, s.n)
+	span.End(err)
+
+	if t.Verbose {
+		t.Logger.Printf("command=%s dur=%s", s.cmd.Name, time.Since(start).Round(time.Millisecond))
+	}
+
+	t.mu.Lock()
+	if t.lastErrors == nil {
+		t.lastErrors = make(map[string]error)
+	}
+	t.lastErrors[s.cmd.Name] = err
+	t.mu.Unlock()
+
+	if t.OnResult != nil {
+		t.OnResult(s.cmd.Name, s.i, s.n, err)
+	}
+	if t.Metrics != nil {
+		if s.i == s.n-1 {
+			t.Metrics.IncIntervals(s.cmd.Name)
+		}
+		if err != nil {
+			t.Metrics.IncErrors(s.cmd.Name)
+		}
+	}
+	if err != nil {
+		if t.OnResult == nil {
+			t.Logger.Printf("%s: %s", s.cmd.Name, err.Error())
+		}
+		return fmt.Errorf("%s: %s", s.cmd.Name, err)
+	}
+	return nil
+}
+
+// step represents a command that has entered step i of n.
+type step struct {
+	cmd  Command
+	i, n int
+}
+
+// AddCommand appends cmd to the ticker's commands. Returns an error if another
+// command already has the same name. Unnamed commands are always added.
+func (t *Ticker) AddCommand(cmd Command) error {
+	if _, ok := t.Command(cmd.Name); ok {
+		return fmt.Errorf("duplicate command name: %q", cmd.Name)
+	}
+	t.Commands = append(t.Commands, cmd)
+	return nil
+}
+
+// Command returns the command with the given name, if one exists.
+func (t *Ticker) Command(name string) (Command, bool) {
+	if name == "" {
+		return Command{}, false
+	}
+	for _, cmd := range t.Commands {
+		if cmd.Name == name {
+			return cmd, true
+		}
+	}
+	return Command{}, false
+}
+
+// MinTickInterval returns the smallest MinTickInterval across all commands.
+// Returns zero if any command does not specify a minimum.
+func (t *Ticker) MinTickInterval() time.Duration {
+	var d time.Duration
+	for _, cmd := range t.Commands {
+		if cmd.MinTickInterval == 0 {
+			return 0
+		} else if d == 0 || cmd.MinTickInterval < d {
+			d = cmd.MinTickInterval
+		}
+	}
+	return d
+}
+
+// AtIntervalBoundary returns true if now is within one tick interval after the
+// start of an interval for any command. Commands without a step never report
+// a boundary. No handlers are invoked.
+func (t *Ticker) AtIntervalBoundary(now time.Time) bool {
+	for _, cmd := range t.Commands {
+		if cmd.Step == 0 || cmd.Interval == 0 {
+			continue
+		}
+		cur := now.Add(-cmd.Offset)
+		if d := cur.Sub(t.truncate(cur, cmd.Interval)); d >= 0 && d < t.TickInterval {
+			return true
+		}
+	}
+	return false
+}
+
+// capture records the current state of r if it has not been captured yet.
+func (t *Ticker) capture(r Restorable) error {
+	if r == nil {
+		return nil
+	}
+	for _, other := range t.captured {
+		if other == r {
+			return nil
+		}
+	}
+
+	if err := r.Capture(); err != nil {
+		return err
+	}
+	t.captured = append(t.captured, r)
+	return nil
+}
+
+// Restore restores the original system state of each command that has
+// captured state. All commands are restored even if one fails and the first
+// error is returned.
+func (t *Ticker) Restore() error {
+	var err error
+	for _, r := range t.captured {
+		if e := r.Restore(); e != nil && err == nil {
+			err = e
+		}
+	}
+	t.captured = nil
+	return err
+}
+
+// Close releases the resources held by each command's closer. Subsequent
+// calls have no effect. Returns all closer errors, prefixed with the command name.
+func (t *Ticker) Close() error {
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+
+	var a []string
+	for _, cmd := range t.Commands {
+		if cmd.Closer == nil {
+			continue
+		}
+		if err := cmd.Closer.Close(); err != nil {
+			a = append(a, fmt.Sprintf("%s: %s", cmd.Name, err))
+		}
+	}
+
+	if len(a) > 0 {
+		return errors.New(strings.Join(a, "; "))
+	}
+	return nil
+}
+
+// startSpan starts a span on the tracer, if one is set.
+func (t *Ticker) startSpan(name string, attrs map[string]interface{}) Span {
+	if t.Tracer == nil {
+		return nopSpan{}
+	}
+	return t.Tracer.StartSpan(name, attrs)
+}
+
+// Schedule represents the hours of the day during which handlers execute.
+type Schedule struct {
+	// Start & end times as offsets from midnight. If end is before start
+	// then the schedule crosses midnight. If equal, it is always active.
+	Start time.Duration
+	End   time.Duration
+
+	// Days of the week that the schedule is active. Active every day if empty.
+	Days []time.Weekday
+}
+
+// ActiveBetween returns a schedule that is active from start until end,
+// each given as a time of day such as "9:00am".
+func ActiveBetween(start, end string) (*Schedule, error) {
+	a, err := time.Parse("3:04pm", start)
+	if err != nil {
+		return nil, fmt.Errorf("parse start: %s", err)
+	}
+	b, err := time.Parse("3:04pm", end)
+	if err != nil {
+		return nil, fmt.Errorf("parse end: %s", err)
+	}
+	return &Schedule{Start: timeOfDay(a), End: timeOfDay(b)}, nil
+}
+
+// Active returns true if t is within the schedule. The time of day is read
+// in t's location, which is local time for times from time.Now().
+func (s *Schedule) Active(t time.Time) bool {
+	if !s.activeDay(t.Weekday()) {
+		return false
+	}
+
+	d := timeOfDay(t)
+	switch {
+	case s.Start < s.End:
+		return d >= s.Start && d < s.End
+	case s.Start > s.End:
+		return d >= s.Start || d < s.End
+	default:
+		return true
+	}
+}
+
+// activeDay returns true if the schedule is active on the day of the week.
+func (s *Schedule) activeDay(day time.Weekday) bool {
+	if len(s.Days) == 0 {
+		return true
+	}
+	for _, v := range s.Days {
+		if v == day {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseWeekdays parses day abbreviations, such as "mon" or "Tue", into days
+// of the week.
+func ParseWeekdays(a []string) ([]time.Weekday, error) {
+	var days []time.Weekday
+	for _, s := range a {
+		day, ok := weekdays[strings.ToLower(s)]
+		if !ok {
+			return nil, fmt.Errorf("invalid weekday: %q", s)
+		}
+		days = append(days, day)
+	}
+	return days, nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// timeOfDay returns the time elapsed since midnight in t's location.
+func timeOfDay(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+}
+
+// position returns the step index & total steps of the interval at cur.
+func (t *Ticker) position(cur time.Time, step, interval time.Duration) (i, n int) {
+	if step == 0 {
+		return 0, 1
+	}
+	i = int(t.truncate(cur, step).Sub(t.truncate(cur, interval)) / step)
+	n = int(interval / step)
+	return i, n
+}
+
+// LastError returns the error returned by the most recent execution of the
+// named command's handler. Returns nil if the handler succeeded or has not
+// been executed.
+func (t *Ticker) LastError(name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.lastErrors[name]
+}
+
+// CompletedIntervals returns the number of intervals of the named command
+// that have reached their final step today.
+func (t *Ticker) CompletedIntervals(name string) int {
+	if t.Now != nil && !midnight(t.Now()).Equal(t.completedDay) {
+		return 0
+	}
+	return t.completed[name]
+}
+
+// IntervalIndex returns the index of the named command's current interval.
+// The first interval executed by the ticker has an index of zero.
+func (t *Ticker) IntervalIndex(name string) int {
+	return t.intervals[name]
+}
+
+// enterInterval increments the interval index of a command when start differs
+// from the start of its previous interval.
+func (t *Ticker) enterInterval(name string, start time.Time) {
+	if t.intervals == nil {
+		t.intervals, t.intervalStarts = make(map[string]int), make(map[string]time.Time)
+	}
+	if prev, ok := t.intervalStarts[name]; ok && !prev.Equal(start) {
+		t.intervals[name]++
+	}
+	t.intervalStarts[name] = start
+}
+
+// incCompleted increments the completed interval count for a command.
+func (t *Ticker) incCompleted(name string, now time.Time) {
+	t.rollover(now)
+	t.completed[name]++
+}
+
+// rollover resets the completed interval counts when now is on a different
+// day than the previous counts. The previous counts are saved & logged as the
+// daily summary if any intervals were completed.
+func (t *Ticker) rollover(now time.Time) {
+	day := midnight(now)
+	if t.completed != nil && day.Equal(t.completedDay) {
+		return
+	}
+
+	if len(t.completed) > 0 {
+		t.summary = Summary{Day: t.completedDay, Completed: t.completed}
+		t.Logger.Printf("summary: %s", t.summary)
+	}
+	t.completed, t.completedDay = make(map[string]int), day
+}
+
+// DailySummary returns the intervals completed on the most recent previous day
+// that had any. Returns a zero summary if no day has been completed yet.
+func (t *Ticker) DailySummary() Summary {
+	return t.summary
+}
+
+// Summary represents the number of intervals completed by each command on a day.
+type Summary struct {
+	Day       time.Time
+	Completed map[string]int
+}
+
+// String returns the day and the counts ordered by command name.
+func (s Summary) String() string {
+	names := make([]string, 0, len(s.Completed))
+	for name := range s.Completed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	buf.WriteString(s.Day.Format("2006-01-02"))
+	for _, name := range names {
+		fmt.Fprintf(&buf, " %s=%d", name, s.Completed[name])
+	}
+	return buf.String()
+}
+
+// midnight returns the start of the day of t in t's location.
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// CommandStatus represents the position of a command within its interval.
+type CommandStatus struct {
+	Name         string    `json:"name"`
+	I            int       `json:"i"`
+	N            int       `json:"n"`
+	Pct          float64   `json:"pct"`
+	NextBoundary time.Time `json:"next_boundary"`
+}
+
+// Status returns the position of each command within its interval at now.
+func (t *Ticker) Status(now time.Time) []CommandStatus {
+	a := make([]CommandStatus, len(t.Commands))
+	for j, cmd := range t.Commands {
+		stepDur := cmd.Step
+		if stepDur == 0 {
+			stepDur = cmd.Interval
+		}
+		cur := now.Add(-cmd.Offset)
+
+		i, n := t.position(cur, stepDur, cmd.Interval)
+		a[j] = CommandStatus{
+			Name:         cmd.Name,
+			I:            i,
+			N:            n,
+			Pct:          Percent(i, n),
+			NextBoundary: t.nextBoundary(cmd, now),
+		}
+	}
+	return a
+}
+
+// NextBoundary returns the earliest start of a new interval across all
+// commands after now. Returns an error if there are no commands.
+func (t *Ticker) NextBoundary(now time.Time) (time.Time, error) {
+	if len(t.Commands) == 0 {
+		return time.Time{}, errors.New("no commands")
+	}
+
+	var next time.Time
+	for _, cmd := range t.Commands {
+		if v := t.nextBoundary(cmd, now); next.IsZero() || v.Before(next) {
+			next = v
+		}
+	}
+	return next, nil
+}
+
+// nextBoundary returns the start of the command's next interval after now.
+func (t *Ticker) nextBoundary(cmd Command, now time.Time) time.Time {
+	return t.truncate(now.Add(-cmd.Offset), cmd.Interval).Add(cmd.Interval + cmd.Offset)
+}
+
+// truncate returns v rounded down to a multiple of d since the anchor time.
+// After waking from sleep, the wake time is used in place of the anchor.
+func (t *Ticker) truncate(v time.Time, d time.Duration) time.Time {
+	anchor := t.Anchor
+	if !t.rebase.IsZero() {
+		anchor = t.rebase
+	}
+	if anchor.IsZero() || d <= 0 {
+		return v.Truncate(d)
+	}
+
+	offset := v.Sub(anchor) % d
+	if offset < 0 {
+		offset += d
+	}
+	return v.Add(-offset)
+}
+
+// Metrics represents an object that counts ticker activity, such as a set of
+// Prometheus counters. Implementations must be safe for concurrent use.
+type Metrics interface {
+	// Increments the number of ticks executed.
+	IncTicks()
+
+	// Increments the number of intervals completed by a command.
+	IncIntervals(name string)
+
+	// Increments the number of handler errors returned by a command.
+	IncErrors(name string)
 }
 
+// Tracer represents an object that records spans, such as an OpenTelemetry tracer.
+type Tracer interface {
+	// Starts a new root span.
+	StartSpan(name string, attrs map[string]interface{}) Span
+}
+
+// Span represents a single traced operation.
+type Span interface {
+	// Starts a new span that is a child of this span.
+	StartSpan(name string, attrs map[string]interface{}) Span
+
+	// Ends the span. The error is nil if the operation succeeded.
+	End(err error)
+}
+
+// nopSpan is used when no tracer is set.
+type nopSpan struct{}
+
+func (nopSpan) StartSpan(name string, attrs map[string]interface{}) Span { return nopSpan{} }
+func (nopSpan) End(err error)                                            {}
+
 // Command represents an action that is executed every step or interval.
 type Command struct {
 	// The name to display for logging purposes.
@@ -81,15 +702,354 @@ type Command struct {
 	Step     time.Duration
 	Interval time.Duration
 
+	// The delay after each step boundary before the handler is executed.
+	// This staggers commands that would otherwise run on the same tick.
+	Offset time.Duration
+
+	// The minimum time between checks for a new step. Coarse commands can
+	// set this to skip ticks between their step boundaries. If zero, the
+	// command is checked on every tick.
+	MinTickInterval time.Duration
+
 	// The function to execute when a step is made in the interval.
 	Handler Handler
+
+	// Optional system state that is modified by the handler. The state is
+	// captured before the handler first executes and restored on shutdown.
+	Restorable Restorable
+
+	// Optional resources held by the handler, such as a spawned process.
+	// These are released when the ticker is closed.
+	Closer io.Closer
+}
+
+// Validate returns an error if the interval is not a positive multiple of the step.
+func (c *Command) Validate() error {
+	if c.Interval <= 0 {
+		return fmt.Errorf("interval must be positive: %s", c.Interval)
+	} else if c.Step < 0 {
+		return fmt.Errorf("step must not be negative: %s", c.Step)
+	} else if c.Step > 0 && c.Interval%c.Step != 0 {
+		return fmt.Errorf("interval must be a multiple of step: %s / %s", c.Interval, c.Step)
+	}
+	return nil
+}
+
+// Restorable represents system state that a handler modifies, such as the
+// dark mode setting, which should be returned to its original value on shutdown.
+type Restorable interface {
+	// Capture records the current state.
+	Capture() error
+
+	// Restore returns the state to the value recorded by Capture.
+	Restore() error
 }
 
+// ResultFunc is called with the step index, total steps, and the error
+// returned by a command's handler.
+type ResultFunc func(name string, i, n int, err error)
+
 // StepHandler is called whenever a new step occurs.
 // It is passed the current step index and the total number of steps per interval.
 type Handler func(i, n int) error
 
+// OnInterval returns a handler that only calls inner on the first step of
+// each interval.
+func OnInterval(inner Handler) Handler {
+	return func(i, n int) error {
+		if i != 0 {
+			return nil
+		}
+		return inner(i, n)
+	}
+}
+
+// OnIntervalEnd returns a handler that only calls inner on the final step of
+// each interval.
+func OnIntervalEnd(inner Handler) Handler {
+	return func(i, n int) error {
+		if i != n-1 {
+			return nil
+		}
+		return inner(i, n)
+	}
+}
+
+// IgnoreErrors returns a handler that calls inner and logs any error to
+// logger instead of returning it, such as for a noisy webhook.
+func IgnoreErrors(logger *log.Logger, inner Handler) Handler {
+	return func(i, n int) error {
+		if err := inner(i, n); err != nil {
+			logger.Printf("ignored error: %s", err)
+		}
+		return nil
+	}
+}
+
+// Percent returns the fraction of the interval completed at the start of
+// step i of n. Returns 0 if n is not positive so a misconfigured command
+// cannot produce NaN or infinite percentages.
+func Percent(i, n int) float64 {
+	if n <= 0 {
+		return 0
+	}
+	return float64(i) / float64(n)
+}
+
+// Easing maps the fraction of the interval completed to the fraction drawn so
+// that progress can speed up or slow down over the interval. Both fractions
+// range from 0 to 1.
+type Easing func(pct float64) float64
+
+// EaseLinear returns pct unchanged.
+func EaseLinear(pct float64) float64 { return pct }
+
+// EaseIn starts slowly and speeds up toward the end of the interval.
+func EaseIn(pct float64) float64 { return pct * pct }
+
+// EaseOut starts quickly and slows down toward the end of the interval.
+func EaseOut(pct float64) float64 { return 1 - (1-pct)*(1-pct) }
+
+// EaseInOut starts & ends slowly and is fastest in the middle of the interval.
+func EaseInOut(pct float64) float64 {
+	if pct < 0.5 {
+		return 2 * pct * pct
+	}
+	return 1 - 2*(1-pct)*(1-pct)
+}
+
+// ParseEasing parses an easing: "linear", "ease_in", "ease_out" or "ease_in_out".
+// A blank string is linear.
+func ParseEasing(s string) (Easing, error) {
+	switch s {
+	case "", "linear":
+		return EaseLinear, nil
+	case "ease_in":
+		return EaseIn, nil
+	case "ease_out":
+		return EaseOut, nil
+	case "ease_in_out":
+		return EaseInOut, nil
+	default:
+		return nil, fmt.Errorf("invalid easing: %q", s)
+	}
+}
+
+// HandlerFunc returns a handler that calls fn with the fraction of the
+// interval completed, from 0 up to but not including 1.
+func HandlerFunc(fn func(pct float64) error) Handler {
+	return func(i, n int) error {
+		return fn(Percent(i, n))
+	}
+}
+
+// NewOverlayHandler returns a handler that writes progress frames to w.
+// The writer is typically the stdin of an overlay helper process that draws
+// the progress on screen. Each frame is a single line of JSON:
+//
+//	{"i":1,"n":4,"pct":0.25}
+func NewOverlayHandler(w io.Writer) Handler {
+	enc := json.NewEncoder(w)
+	return func(i, n int) error {
+		if err := enc.Encode(progressFrame{I: i, N: n, Pct: Percent(i, n)}); err != nil {
+			return fmt.Errorf("write overlay frame: %s", err)
+		}
+		return nil
+	}
+}
+
+// progressFrame is the progress of a single step, encoded as JSON.
+type progressFrame struct {
+	I   int     `json:"i"`
+	N   int     `json:"n"`
+	Pct float64 `json:"pct"`
+}
+
+// SocketHandler writes progress frames to a Unix domain socket, such as one
+// opened by a desktop widget. Frames use the same format as NewOverlayHandler.
+// The connection is opened lazily and reopened on the step after a failure.
+type SocketHandler struct {
+	// The path to the Unix domain socket.
+	Path string
+
+	conn net.Conn
+}
+
+// NewSocketHandler returns a handler that writes progress frames to the Unix
+// domain socket at path.
+func NewSocketHandler(path string) Handler {
+	h := &SocketHandler{Path: path}
+	return h.Handle
+}
+
+// Handle writes the progress of step i of n to the socket.
+func (h *SocketHandler) Handle(i, n int) error {
+	// Connect if there's no open connection.
+	if h.conn == nil {
+		conn, err := net.Dial("unix", h.Path)
+		if err != nil {
+			return fmt.Errorf("dial socket: %s", err)
+		}
+		h.conn = conn
+	}
+
+	// Drop the connection on failure so the next step reconnects.
+	if err := json.NewEncoder(h.conn).Encode(progressFrame{I: i, N: n, Pct: Percent(i, n)}); err != nil {
+		h.Close()
+		return fmt.Errorf("write socket frame: %s", err)
+	}
+	return nil
+}
+
+// Close closes the connection to the socket, if open.
+func (h *SocketHandler) Close() error {
+	if h.conn == nil {
+		return nil
+	}
+	err := h.conn.Close()
+	h.conn = nil
+	return err
+}
+
+// StartOverlayHelper starts the overlay helper at path and returns its stdin.
+// Closing the returned writer signals the helper to exit and waits for it.
+func StartOverlayHelper(path string, args ...string) (io.WriteCloser, error) {
+	cmd := exec.Command(path, args...)
+	w, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	} else if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &overlayHelper{WriteCloser: w, cmd: cmd}, nil
+}
+
+// overlayHelper represents the stdin of a running overlay helper process.
+type overlayHelper struct {
+	io.WriteCloser
+	cmd *exec.Cmd
+}
+
+// Close closes the helper's stdin and waits for the helper to exit.
+func (h *overlayHelper) Close() error {
+	err := h.WriteCloser.Close()
+	if e := h.cmd.Wait(); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// ConsoleBarWidth is the number of characters in the console progress bar.
+const ConsoleBarWidth = 10
+
+// TextOptions are options for the handlers that write the remaining time as
+// text. Options that an output does not support are ignored.
+type TextOptions struct {
+	// How the remaining minutes are rounded.
+	Rounding Rounding
+
+	// If MaxFontSize is non-zero, a "size=" parameter is appended to outputs
+	// in the SwiftBar/xbar plugin format. The size grows from MinFontSize to
+	// MaxFontSize with the percent complete.
+	MinFontSize int
+	MaxFontSize int
+}
+
+// params returns the plugin parameters for step i of n, if any.
+func (opt TextOptions) params(i, n int) string {
+	if opt.MaxFontSize == 0 {
+		return ""
+	}
+	size := opt.MinFontSize + int(Percent(i, n)*float64(opt.MaxFontSize-opt.MinFontSize))
+	return fmt.Sprintf(" | size=%d", size)
+}
+
+// NewConsoleHandler returns a handler that writes a textual progress bar to w
+// on every step, such as "[#####-----] 50% (7m left)". Each bar begins with a
+// carriage return so it overwrites the previous bar on a terminal.
+func NewConsoleHandler(w io.Writer, step time.Duration, opt TextOptions) Handler {
+	return func(i, n int) error {
+		pct := Percent(i, n)
+		filled := int(pct * ConsoleBarWidth)
+		_, err := fmt.Fprintf(w, "\r[%s%s] %d%% (%s left)",
+			strings.Repeat("#", filled), strings.Repeat("-", ConsoleBarWidth-filled),
+			int(pct*100), FormatRemaining(RemainingTime(i, n, step), opt.Rounding),
+		)
+		return err
+	}
+}
+
+// NewITermBadgeHandler returns a handler that sets the iTerm2 badge to the
+// remaining time on every step, such as "12m", using iTerm2's proprietary
+// escape sequence. The writer is typically the terminal's stdout.
+func NewITermBadgeHandler(w io.Writer, step time.Duration, opt TextOptions) Handler {
+	return func(i, n int) error {
+		text := FormatRemaining(RemainingTime(i, n, step), opt.Rounding)
+		_, err := fmt.Fprintf(w, "\x1b]1337;SetBadgeFormat=%s\a", base64.StdEncoding.EncodeToString([]byte(text)))
+		return err
+	}
+}
+
+// NewStatusTextHandler returns a handler that writes the remaining time to path
+// on every step in the SwiftBar/xbar plugin format, such as "7m left". The
+// font size options are supported.
+func NewStatusTextHandler(path string, step time.Duration, opt TextOptions) Handler {
+	return func(i, n int) error {
+		text := FormatRemaining(RemainingTime(i, n, step), opt.Rounding) + " left" + opt.params(i, n)
+		return ioutil.WriteFile(path, []byte(text+"\n"), 0666)
+	}
+}
+
+// NewTaskFileHandler returns a handler that writes the current interval's
+// label to path at the start of each interval and clears it on the final step.
+// An interval with a single step is cleared immediately since its first step
+// is also its final step. The label function is passed the number of intervals
+// started before this one.
+func NewTaskFileHandler(path string, label func(intervalIndex int) string) Handler {
+	var index int
+	return func(i, n int) error {
+		if i == n-1 {
+			if i == 0 {
+				index++
+			}
+			return ioutil.WriteFile(path, nil, 0666)
+		} else if i == 0 {
+			if err := ioutil.WriteFile(path, []byte(label(index)+"\n"), 0666); err != nil {
+				return err
+			}
+			index++
+		}
+		return nil
+	}
+}
+
+// NewExecHandler returns a handler that executes the named program on every
+// step. The "{i}", "{n}" and "{pct}" placeholders in args are replaced with
+// the step index, total steps and the percent complete, respectively.
+func NewExecHandler(exec CommandExecutor, name string, args []string) Handler {
+	return func(i, n int) error {
+		r := strings.NewReplacer(
+			"{i}", strconv.Itoa(i),
+			"{n}", strconv.Itoa(n),
+			"{pct}", strconv.FormatFloat(Percent(i, n), 'f', -1, 64),
+		)
+
+		a := make([]string, len(args))
+		for j := range args {
+			a[j] = r.Replace(args[j])
+		}
+
+		if b, err := exec(name, a, nil); err != nil && len(bytes.TrimSpace(b)) == 0 {
+			return fmt.Errorf("exec %s: %s", name, err)
+		} else if err != nil {
+			return fmt.Errorf("exec %s: %s: %s", name, err, bytes.TrimSpace(b))
+		}
+		return nil
+	}
+}
+
 // CommandExecutor is the signature for wrapping os/exec execution.
+// The stdin reader may be nil if the command does not read any input.
 type CommandExecutor func(name string, args []string, stdin io.Reader) ([]byte, error)
 
 // DefaultCommandExecutor is the default implementation of CommandExecutor.
@@ -99,11 +1059,189 @@ func DefaultCommandExecutor(name string, args []string, stdin io.Reader) ([]byte
 	return cmd.CombinedOutput()
 }
 
-// ParseColor parses a hex color.
+// NewDryRunCommandExecutor returns a CommandExecutor that logs each command
+// and its stdin to logger instead of executing it.
+func NewDryRunCommandExecutor(logger *log.Logger) CommandExecutor {
+	return func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		var input []byte
+		if stdin != nil {
+			b, err := ioutil.ReadAll(stdin)
+			if err != nil {
+				return nil, err
+			}
+			input = b
+		}
+
+		logger.Printf("exec: %s %s\n%s", name, strings.Join(args, " "), input)
+		return nil, nil
+	}
+}
+
+// WithRetry returns a CommandExecutor that invokes exec up to attempts times
+// until it succeeds, waiting backoff between each attempt. Stdin is buffered
+// so that it can be replayed on every attempt. The command is always executed
+// at least once.
+func WithRetry(exec CommandExecutor, attempts int, backoff time.Duration) CommandExecutor {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		// Buffer stdin so it can be read multiple times.
+		var input []byte
+		if stdin != nil {
+			b, err := ioutil.ReadAll(stdin)
+			if err != nil {
+				return nil, err
+			}
+			input = b
+		}
+
+		// Execute until success or until we run out of attempts.
+		var b []byte
+		var err error
+		for i := 0; i < attempts; i++ {
+			if i > 0 {
+				time.Sleep(backoff)
+			}
+
+			// Preserve a nil stdin for commands that don't read input.
+			var r io.Reader
+			if stdin != nil {
+				r = bytes.NewReader(input)
+			}
+
+			if b, err = exec(name, args, r); err == nil {
+				return b, nil
+			}
+		}
+		return b, err
+	}
+}
+
+// WithLogging returns a CommandExecutor that logs each command's name & args
+// to logger before invoking exec and logs the result once it completes. Stdin
+// is not logged.
+func WithLogging(exec CommandExecutor, logger *log.Logger) CommandExecutor {
+	return func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		logger.Printf("exec: %s", strings.Join(append([]string{name}, args...), " "))
+		b, err := exec(name, args, stdin)
+		if err != nil {
+			logger.Printf("exit: %s: %s", name, err)
+		} else {
+			logger.Printf("exit: %s: ok", name)
+		}
+		return b, err
+	}
+}
+
+// RemainingTime returns the time remaining in an interval at the start of step i of n.
+func RemainingTime(i, n int, step time.Duration) time.Duration {
+	return time.Duration(n-i) * step
+}
+
+// Rounding is the method used to round a duration to whole minutes for display.
+type Rounding int
+
+const (
+	RoundFloor Rounding = iota
+	RoundCeil
+	RoundNearest
+)
+
+// ParseRounding parses a rounding method: "floor", "ceil", or "round".
+func ParseRounding(s string) (Rounding, error) {
+	switch s {
+	case "floor":
+		return RoundFloor, nil
+	case "ceil":
+		return RoundCeil, nil
+	case "round":
+		return RoundNearest, nil
+	default:
+		return 0, fmt.Errorf("invalid rounding: %q", s)
+	}
+}
+
+// FormatRemaining returns d as whole minutes, such as "5m", using r to round.
+func FormatRemaining(d time.Duration, r Rounding) string {
+	var m float64
+	switch r {
+	case RoundCeil:
+		m = math.Ceil(d.Minutes())
+	case RoundNearest:
+		m = math.Floor(d.Minutes() + 0.5)
+	default:
+		m = math.Floor(d.Minutes())
+	}
+	return fmt.Sprintf("%dm", int(m))
+}
+
+// NamedColors maps the basic CSS color names to their colors.
+var NamedColors = map[string]color.RGBA{
+	"black":   {R: 0x00, G: 0x00, B: 0x00, A: 0xFF},
+	"silver":  {R: 0xC0, G: 0xC0, B: 0xC0, A: 0xFF},
+	"gray":    {R: 0x80, G: 0x80, B: 0x80, A: 0xFF},
+	"grey":    {R: 0x80, G: 0x80, B: 0x80, A: 0xFF},
+	"white":   {R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF},
+	"maroon":  {R: 0x80, G: 0x00, B: 0x00, A: 0xFF},
+	"red":     {R: 0xFF, G: 0x00, B: 0x00, A: 0xFF},
+	"purple":  {R: 0x80, G: 0x00, B: 0x80, A: 0xFF},
+	"fuchsia": {R: 0xFF, G: 0x00, B: 0xFF, A: 0xFF},
+	"magenta": {R: 0xFF, G: 0x00, B: 0xFF, A: 0xFF},
+	"green":   {R: 0x00, G: 0x80, B: 0x00, A: 0xFF},
+	"lime":    {R: 0x00, G: 0xFF, B: 0x00, A: 0xFF},
+	"olive":   {R: 0x80, G: 0x80, B: 0x00, A: 0xFF},
+	"yellow":  {R: 0xFF, G: 0xFF, B: 0x00, A: 0xFF},
+	"navy":    {R: 0x00, G: 0x00, B: 0x80, A: 0xFF},
+	"blue":    {R: 0x00, G: 0x00, B: 0xFF, A: 0xFF},
+	"teal":    {R: 0x00, G: 0x80, B: 0x80, A: 0xFF},
+	"aqua":    {R: 0x00, G: 0xFF, B: 0xFF, A: 0xFF},
+	"cyan":    {R: 0x00, G: 0xFF, B: 0xFF, A: 0xFF},
+	"orange":  {R: 0xFF, G: 0xA5, B: 0x00, A: 0xFF},
+}
+
+// AutoColor is a color setting that selects a foreground that contrasts with
+// the background. It is not accepted by ParseColor.
+const AutoColor = "auto"
+
+// ContrastColor returns white for dark colors and black for light colors so
+// that the result is readable against c.
+func ContrastColor(c color.RGBA) color.RGBA {
+	// Above this luminance, black has a higher contrast ratio than white.
+	if Luminance(c) > 0.179 {
+		return color.RGBA{A: 0xFF}
+	}
+	return color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+}
+
+// Luminance returns the relative luminance of c from 0 (black) to 1 (white).
+func Luminance(c color.RGBA) float64 {
+	linear := func(v uint8) float64 {
+		f := float64(v) / 0xFF
+		if f <= 0.03928 {
+			return f / 12.92
+		}
+		return math.Pow((f+0.055)/1.055, 2.4)
+	}
+	return 0.2126*linear(c.R) + 0.7152*linear(c.G) + 0.0722*linear(c.B)
+}
+
+// ParseColor parses a hex color or a case-insensitive color name. Hex colors
+// may use the 3-digit shorthand, such as "#f00" for "#ff0000".
 func ParseColor(s string) (color.RGBA, error) {
+	if c, ok := NamedColors[strings.ToLower(s)]; ok {
+		return c, nil
+	}
+
 	m := regexp.MustCompile(`^#?([0-9a-fA-F]{2})([0-9a-fA-F]{2})([0-9a-fA-F]{2})$`).FindStringSubmatch(s)
 	if m == nil {
-		return color.RGBA{}, fmt.Errorf("cannot parse color: %q", s)
+		// Expand each digit of the shorthand format.
+		if m = regexp.MustCompile(`^#?([0-9a-fA-F])([0-9a-fA-F])([0-9a-fA-F])$`).FindStringSubmatch(s); m == nil {
+			return color.RGBA{}, fmt.Errorf("cannot parse color: %q", s)
+		}
+		for i := 1; i < len(m); i++ {
+			m[i] += m[i]
+		}
 	}
 
 	r, _ := strconv.ParseUint(m[1], 16, 8)
@@ -139,5 +1277,22 @@ func transposeUint8(a, b uint8, pct float64) uint8 {
 // NowFunc is a function that returns the current time.
 type NowFunc func() time.Time
 
+// Clock represents a source of time that can be replaced in tests.
+type Clock interface {
+	// Returns the current time.
+	Now() time.Time
+
+	// Returns a channel that receives the current time after d has elapsed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// DefaultClock is the Clock backed by the system time.
+var DefaultClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
 func warn(v ...interface{})              { fmt.Fprintln(os.Stderr, v...) }
 func warnf(msg string, v ...interface{}) { fmt.Fprintf(os.Stderr, msg+"\n", v...) }
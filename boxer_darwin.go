@@ -1,48 +1,349 @@
 package boxer
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
+	"image/jpeg"
 	"image/png"
+	"io/ioutil"
+	"log"
+	"math"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 // OSAScriptPath is the path to the "osascript" binary.
 const OSAScriptPath = `/usr/bin/osascript`
 
+// WallpaperHandler visualizes steps with the desktop wallpaper.
+type WallpaperHandler struct {
+	// The function used to execute OS commands.
+	Exec CommandExecutor
+
+	// Returns the size of the wallpaper to generate.
+	Sizer DesktopSizer
+
+	// Generates the wallpaper image for a given step.
+	Generator WallpaperGenerator
+
+	// Optional generator used instead of Generator while the system
+	// appearance is dark. The appearance is checked on every step.
+	DarkGenerator WallpaperGenerator
+
+	// The directory that generated wallpapers are cached in.
+	Path string
+
+	// An identifier for the generator's settings. It is included in the
+	// cached filename so that changing settings invalidates cached images.
+	Key string
+
+	// The file extension of cached wallpapers, which determines the image
+	// format. Either ".png" or ".jpg". Defaults to ".png".
+	Ext string
+
+	// If true, the wallpaper is regenerated on every step instead of being
+	// cached. Generators that draw the current time or other changing content
+	// should disable caching. Uncached wallpapers alternate between two files
+	// since the desktop is not refreshed when set to an unchanged path.
+	DisableCache bool
+
+	// Sets the desktop to the generated image. Defaults to
+	// DefaultWallpaperSetter.
+	Setter WallpaperSetter
+
+	// Optional lock screen that each generated image is also copied to. The
+	// original lock screen image is put back by Restore.
+	LockScreen *LockScreen
+
+	// Number of intermediate frames set over the transition duration to
+	// animate the fill from the previous step. Disabled if zero.
+	TransitionFrames   int
+	TransitionDuration time.Duration
+
+	original string // wallpaper path before the handler first ran
+	n        int    // number of steps handled, used to alternate uncached paths
+}
+
 // NewWallpaperHandler returns a handler for visualizing steps with the desktop wallpaper.
 func NewWallpaperHandler(exec CommandExecutor, sizer DesktopSizer, generator WallpaperGenerator, path string) Handler {
-	return func(i, n int) error {
-		// Retrieve desktop size.
-		w, h, err := sizer(exec)
-		if err != nil {
-			return fmt.Errorf("desktop size: %s", err)
+	h := &WallpaperHandler{
+		Exec:      exec,
+		Sizer:     sizer,
+		Generator: generator,
+		Path:      path,
+	}
+	return h.Handle
+}
+
+// Handle generates and sets the wallpaper for step i of n.
+func (h *WallpaperHandler) Handle(i, n int) error {
+	// Switch between two uncached paths on every step.
+	alt := h.n % 2
+	h.n++
+
+	// Retrieve desktop size.
+	width, height, err := h.Sizer(h.Exec)
+	if err != nil {
+		return fmt.Errorf("desktop size: %s", err)
+	}
+
+	// Use the dark generator if the system appearance is dark.
+	generator, dark := h.Generator, false
+	if h.DarkGenerator != nil {
+		if dark, err = IsDarkMode(h.Exec); err != nil {
+			return fmt.Errorf("appearance: %s", err)
+		} else if dark {
+			generator = h.DarkGenerator
 		}
+	}
 
-		// Generate wallpaper if it doesn't exist.
-		// The wallpaper is saved to a common location format so we can tell if
-		// the desktop size changes and recompute a wallpaper on the fly.
-		imgpath := filepath.Join(path, fmt.Sprintf("wallpaper_%04d_%04d_%02d_%02d.png", w, h, i, n))
-		if _, err := os.Stat(imgpath); os.IsNotExist(err) {
-			if err := generator(imgpath, w, h, float64(i)/float64(n)); err != nil {
-				return fmt.Errorf("generate wallpaper: %s", err)
-			}
+	// Animate the fill from the previous step. The first step of an interval
+	// is not animated since the fill starts over.
+	if h.TransitionFrames > 0 && i > 0 {
+		if err := h.transition(generator, width, height, i, n); err != nil {
+			return err
 		}
+	}
 
-		// Execute AppleScript to update the current background.
-		src := fmt.Sprintf(strings.TrimSpace(setWallpaperScript), imgpath)
-		if b, err := exec(OSAScriptPath, nil, strings.NewReader(src)); err != nil {
-			return fmt.Errorf("exec: %s", b)
+	// Generate wallpaper if it doesn't exist.
+	// The wallpaper is saved to a common location format so we can tell if
+	// the desktop size changes and recompute a wallpaper on the fly.
+	imgpath := filepath.Join(h.Path, h.filename(width, height, i, n, dark, alt))
+	if h.DisableCache {
+		if err := generator(imgpath, width, height, Percent(i, n)); err != nil {
+			return fmt.Errorf("generate wallpaper: %s", err)
+		}
+	} else if _, err := os.Stat(imgpath); os.IsNotExist(err) {
+		if err := generator(imgpath, width, height, Percent(i, n)); err != nil {
+			return fmt.Errorf("generate wallpaper: %s", err)
+		}
+	}
+
+	if err := h.setter()(h.Exec, imgpath); err != nil {
+		return err
+	}
+	if h.LockScreen != nil {
+		h.LockScreen.Set(h.Exec, imgpath)
+	}
+	return nil
+}
+
+// transition generates & sets frames between the previous step and step i.
+// Frames are not cached since they are overwritten on each transition.
+func (h *WallpaperHandler) transition(generator WallpaperGenerator, width, height, i, n int) error {
+	from, to := Percent(i-1, n), Percent(i, n)
+	delay := h.TransitionDuration / time.Duration(h.TransitionFrames)
+	for k := 1; k <= h.TransitionFrames; k++ {
+		path := filepath.Join(h.Path, h.alternate("wallpaper_frame", k-1))
+		pct := from + (to-from)*float64(k)/float64(h.TransitionFrames+1)
+		if err := generator(path, width, height, pct); err != nil {
+			return fmt.Errorf("generate transition: %s", err)
+		} else if err := h.setter()(h.Exec, path); err != nil {
+			return err
+		}
+		time.Sleep(delay)
+	}
+	return nil
+}
+
+// ext returns the file extension of generated wallpapers.
+func (h *WallpaperHandler) ext() string {
+	if h.Ext == "" {
+		return ".png"
+	}
+	return h.Ext
+}
+
+// alternate returns one of two filenames with prefix for an uncached image,
+// based on whether k is even or odd. Consecutive images must not share a path
+// since setting an unchanged path is ignored by Finder & System Events.
+func (h *WallpaperHandler) alternate(prefix string, k int) string {
+	return fmt.Sprintf("%s_%d%s", prefix, k%2, h.ext())
+}
+
+// setter returns the wallpaper setter, or the default if one is not set.
+func (h *WallpaperHandler) setter() WallpaperSetter {
+	if h.Setter == nil {
+		return DefaultWallpaperSetter
+	}
+	return h.Setter
+}
+
+// filename returns the cached filename for a given size and step. Dark
+// wallpapers are cached separately from light wallpapers. If caching is
+// disabled, the filename alternates based on alt instead.
+func (h *WallpaperHandler) filename(width, height, i, n int, dark bool, alt int) string {
+	ext := h.ext()
+	if h.DisableCache {
+		return h.alternate("wallpaper_live", alt)
+	}
+	if dark {
+		ext = "_dark" + ext
+	}
+
+	if h.Key == "" {
+		return fmt.Sprintf("wallpaper_%04d_%04d_%02d_%02d%s", width, height, i, n, ext)
+	}
+	return fmt.Sprintf("wallpaper_%s_%04d_%04d_%02d_%02d%s", h.Key, width, height, i, n, ext)
+}
+
+// IsDarkMode returns true if the system appearance is dark.
+func IsDarkMode(exec CommandExecutor) (bool, error) {
+	b, err := exec(OSAScriptPath, nil, strings.NewReader(strings.TrimSpace(getAppearanceScript)))
+	if err != nil {
+		return false, fmt.Errorf("exec: %s", b)
+	}
+
+	switch s := strings.TrimSpace(string(b)); s {
+	case "Dark":
+		return true, nil
+	case "Light":
+		return false, nil
+	default:
+		return false, fmt.Errorf("unexpected appearance: %q", s)
+	}
+}
+
+// getAppearanceScript returns "Dark" or "Light" for the system appearance.
+const getAppearanceScript = `
+tell application "System Events"
+  tell appearance preferences
+    if dark mode then
+      return "Dark"
+    end if
+  end tell
+end tell
+return "Light"
+`
+
+// Capture records the user's current wallpaper so it can be restored later.
+func (h *WallpaperHandler) Capture() error {
+	b, err := h.Exec(OSAScriptPath, nil, strings.NewReader(strings.TrimSpace(getWallpaperScript)))
+	if err != nil {
+		return fmt.Errorf("exec: %s", b)
+	}
+	h.original = strings.TrimSpace(string(b))
+	return nil
+}
+
+// Restore sets the wallpaper back to the one recorded by Capture and puts
+// back the original lock screen image, if it was replaced.
+func (h *WallpaperHandler) Restore() error {
+	if h.LockScreen != nil {
+		if err := h.LockScreen.Restore(h.Exec); err != nil {
+			return err
 		}
+	}
+	if h.original == "" {
 		return nil
 	}
+
+	return h.setter()(h.Exec, h.original)
+}
+
+// WallpaperSetter sets the desktop wallpaper to the image at path.
+type WallpaperSetter func(exec CommandExecutor, path string) error
+
+// DefaultWallpaperSetter sets the wallpaper using Finder.
+func DefaultWallpaperSetter(exec CommandExecutor, path string) error {
+	return setWallpaper(exec, setWallpaperScript, path)
+}
+
+// SystemEventsWallpaperSetter sets the wallpaper of every desktop using
+// System Events. Unlike Finder, this updates all displays & Spaces.
+func SystemEventsWallpaperSetter(exec CommandExecutor, path string) error {
+	return setWallpaper(exec, setAllWallpapersScript, path)
+}
+
+// setWallpaper executes script with path substituted to set the wallpaper.
+func setWallpaper(exec CommandExecutor, script, path string) error {
+	src := fmt.Sprintf(strings.TrimSpace(script), escapeAppleScriptString(path))
+	if b, err := exec(OSAScriptPath, nil, strings.NewReader(src)); err != nil {
+		return fmt.Errorf("exec: %s", b)
+	}
+	return nil
+}
+
+// LockScreenPath is the image shown behind the login window.
+const LockScreenPath = `/Library/Caches/com.apple.desktop.admin.png`
+
+// SudoPath is the path to the "sudo" binary.
+const SudoPath = `/usr/bin/sudo`
+
+// LockScreenBackupPath is where the original lock screen image is kept while
+// it is replaced.
+const LockScreenBackupPath = `/Library/Caches/com.apple.desktop.admin.boxer.png`
+
+// LockScreen copies images to the lock screen. Copying is done with a
+// non-interactive sudo so it requires passwordless sudo access. If copying
+// fails then a warning is logged once and the lock screen is not updated again.
+type LockScreen struct {
+	backedUp bool // true if the original image is at LockScreenBackupPath
+	disabled bool // true after a copy fails
+
+	// Logger used to report that the lock screen is disabled.
+	Logger *log.Logger
+}
+
+// NewLockScreen returns a new instance of LockScreen.
+func NewLockScreen(logger *log.Logger) *LockScreen {
+	return &LockScreen{Logger: logger}
+}
+
+// Set copies the image at path to the lock screen. The original image is
+// backed up before it is first replaced.
+func (l *LockScreen) Set(exec CommandExecutor, path string) {
+	if l.disabled {
+		return
+	}
+
+	if !l.backedUp {
+		if err := l.sudo(exec, "cp", LockScreenPath, LockScreenBackupPath); err != nil {
+			l.disable(err)
+			return
+		}
+		l.backedUp = true
+	}
+
+	if err := l.sudo(exec, "cp", path, LockScreenPath); err != nil {
+		l.disable(err)
+	}
+}
+
+// Restore moves the original image back to the lock screen, if it was replaced.
+func (l *LockScreen) Restore(exec CommandExecutor) error {
+	if !l.backedUp {
+		return nil
+	}
+	if err := l.sudo(exec, "mv", LockScreenBackupPath, LockScreenPath); err != nil {
+		return fmt.Errorf("restore lock screen: %s", err)
+	}
+	l.backedUp = false
+	return nil
+}
+
+// disable stops further updates and logs a warning with the reason.
+func (l *LockScreen) disable(err error) {
+	l.disabled = true
+	l.Logger.Printf("lock screen disabled: %s", err)
+}
+
+// sudo executes the named program with a non-interactive sudo.
+func (l *LockScreen) sudo(exec CommandExecutor, name string, args ...string) error {
+	if b, err := exec(SudoPath, append([]string{"-n", name}, args...), nil); err != nil {
+		return errors.New(string(bytes.TrimSpace(b)))
+	}
+	return nil
 }
 
 const setWallpaperScript = `
@@ -51,12 +352,196 @@ tell application "Finder"
 end tell
 `
 
+const setAllWallpapersScript = `
+tell application "System Events"
+  tell every desktop to set picture to "%s"
+end tell
+`
+
+const getWallpaperScript = `
+tell application "Finder"
+  get POSIX path of (desktop picture as alias)
+end tell
+`
+
+// NewArchiveHandler returns a handler that saves the completed wallpaper of
+// each interval to path. Archived files are named with the time the interval
+// completed and the index of the interval since the handler was created.
+func NewArchiveHandler(exec CommandExecutor, sizer DesktopSizer, generator WallpaperGenerator, now NowFunc, path string) Handler {
+	var index int
+	return func(i, n int) error {
+		// Only archive on the last step of the interval.
+		if i != n-1 {
+			return nil
+		}
+
+		// Retrieve desktop size.
+		w, h, err := sizer(exec)
+		if err != nil {
+			return fmt.Errorf("desktop size: %s", err)
+		}
+
+		// Generate the completed wallpaper into the archive.
+		imgpath := filepath.Join(path, fmt.Sprintf("wallpaper_%s_%04d.png", now().Format("20060102T150405"), index))
+		if err := generator(imgpath, w, h, 1.0); err != nil {
+			return fmt.Errorf("generate archive: %s", err)
+		}
+		index++
+
+		return nil
+	}
+}
+
+// PruneWallpapers removes all but the keep most recently modified wallpapers in dir.
+// Files removed concurrently by another process are ignored. Returns an error
+// if keep is negative.
+func PruneWallpapers(dir string, keep int) error {
+	if keep < 0 {
+		return fmt.Errorf("invalid keep count: %d", keep)
+	}
+
+	fis, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// Filter out files that are not generated wallpapers.
+	var a []os.FileInfo
+	for _, fi := range fis {
+		if !fi.IsDir() && wallpaperFilenameRegexp.MatchString(fi.Name()) {
+			a = append(a, fi)
+		}
+	}
+
+	// Sort by newest first and remove everything after the first keep files.
+	sort.Slice(a, func(i, j int) bool { return a[i].ModTime().After(a[j].ModTime()) })
+	for i := keep; i < len(a); i++ {
+		if err := os.Remove(filepath.Join(dir, a[i].Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// wallpaperFilenameRegexp matches the filenames generated by the wallpaper handler.
+// Dimensions & step numbers are zero-padded but may be wider than the padding.
+var wallpaperFilenameRegexp = regexp.MustCompile(`^wallpaper_(\w+_)?\d+_\d+_\d+_\d+(_dark)?\.(png|jpg)$`)
+
 // WallpaperGenerator generates a wallpaper at the given path.
 type WallpaperGenerator func(path string, w, h int, pct float64) error
 
+// FillDirection is the edge of the wallpaper that the foreground grows from.
+type FillDirection int
+
+const (
+	// FillTop grows the foreground downward from the top edge.
+	FillTop FillDirection = iota
+
+	// FillBottom grows the foreground upward from the bottom edge.
+	FillBottom
+
+	// FillLeft grows the foreground rightward from the left edge.
+	FillLeft
+
+	// FillRight grows the foreground leftward from the right edge.
+	FillRight
+)
+
+// ParseFillDirection parses "top", "bottom", "left" or "right" into a fill direction.
+func ParseFillDirection(s string) (FillDirection, error) {
+	switch s {
+	case "", "top":
+		return FillTop, nil
+	case "bottom":
+		return FillBottom, nil
+	case "left":
+		return FillLeft, nil
+	case "right":
+		return FillRight, nil
+	default:
+		return 0, fmt.Errorf("invalid fill direction: %q", s)
+	}
+}
+
+// WatermarkPosition is the corner of the wallpaper that a watermark is drawn in.
+type WatermarkPosition int
+
+const (
+	WatermarkBottomRight WatermarkPosition = iota
+	WatermarkBottomLeft
+	WatermarkTopRight
+	WatermarkTopLeft
+)
+
+// ParseWatermarkPosition parses a corner such as "bottom-right" into a position.
+func ParseWatermarkPosition(s string) (WatermarkPosition, error) {
+	switch s {
+	case "", "bottom-right":
+		return WatermarkBottomRight, nil
+	case "bottom-left":
+		return WatermarkBottomLeft, nil
+	case "top-right":
+		return WatermarkTopRight, nil
+	case "top-left":
+		return WatermarkTopLeft, nil
+	default:
+		return 0, fmt.Errorf("invalid watermark position: %q", s)
+	}
+}
+
+// WatermarkPadding is the distance, in pixels, between a watermark and the
+// edges of the wallpaper.
+const WatermarkPadding = 20
+
+// LoadImage reads and decodes a PNG or JPEG image from path, such as a
+// background image or watermark.
+func LoadImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	m, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %s", err)
+	}
+	return m, nil
+}
+
+// WallpaperOptions represents drawing options shared by wallpaper generators.
+type WallpaperOptions struct {
+	// Edge of the wallpaper that the foreground grows from.
+	Direction FillDirection
+
+	// Image composited over a corner of the wallpaper. Optional.
+	Watermark         image.Image
+	WatermarkPosition WatermarkPosition
+
+	// Quality used when the wallpaper path has a ".jpg" or ".jpeg" extension.
+	// Ranges from 1 to 100. Defaults to jpeg.DefaultQuality.
+	Quality int
+
+	// Color of a line drawn along the edge of the foreground. Optional.
+	// The width, in pixels, defaults to DefaultDividerWidth.
+	DividerColor color.Color
+	DividerWidth int
+}
+
+// DefaultDividerWidth is the default width, in pixels, of the divider line.
+const DefaultDividerWidth = 2
+
 // GenerateWallpaper generates a PNG wallpaper with a given size and color.
 // The wallpaper will draw the foreground covering pct percent of the image.
 func NewWallpaperGenerator(now NowFunc, times []time.Time, foregrounds, backgrounds []color.RGBA) (WallpaperGenerator, error) {
+	return NewWallpaperGeneratorWithOptions(now, times, foregrounds, backgrounds, WallpaperOptions{})
+}
+
+// NewWallpaperGeneratorWithOptions is the same as NewWallpaperGenerator except
+// that the wallpaper is drawn with the given options.
+func NewWallpaperGeneratorWithOptions(now NowFunc, times []time.Time, foregrounds, backgrounds []color.RGBA, opt WallpaperOptions) (WallpaperGenerator, error) {
 	// Validate and normalize foreground colors.
 	if len(foregrounds) == 0 {
 		return nil, fmt.Errorf("foreground color required")
@@ -111,30 +596,276 @@ func NewWallpaperGenerator(now NowFunc, times []time.Time, foregrounds, backgrou
 		fg := TransposeColor(foregrounds[0], foregrounds[1], transPct)
 		bg := TransposeColor(backgrounds[0], backgrounds[1], transPct)
 
-		// Ensure the parent directory exists.
-		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
-			return fmt.Errorf("mkdir: %s", err)
+		return writeWallpaper(path, drawWallpaper(w, h, pct, fg, &image.Uniform{bg}, opt), opt)
+	}, nil
+}
+
+// NewPaletteLerpWallpaperGenerator returns a generator that blends the
+// foreground through each color of the palette as pct goes from 0 to 1.
+func NewPaletteLerpWallpaperGenerator(background color.RGBA, palette []color.RGBA, opt WallpaperOptions) WallpaperGenerator {
+	return func(path string, w, h int, pct float64) error {
+		return writeWallpaper(path, drawWallpaper(w, h, pct, LerpPalette(palette, pct), &image.Uniform{background}, opt), opt)
+	}
+}
+
+// NewCyclingWallpaperGenerator returns a generator that fills with a different
+// foreground color each interval, cycling through foregrounds in order. The
+// index function returns the index of the current interval.
+func NewCyclingWallpaperGenerator(index func() int, foregrounds []color.RGBA, background color.RGBA, opt WallpaperOptions) WallpaperGenerator {
+	return func(path string, w, h int, pct float64) error {
+		fg := foregrounds[index()%len(foregrounds)]
+		return writeWallpaper(path, drawWallpaper(w, h, pct, fg, &image.Uniform{background}, opt), opt)
+	}
+}
+
+// NewGradientWallpaperGenerator returns a generator that paints a vertical
+// gradient background from the top color to the bottom color and overlays
+// the foreground color covering pct percent of the image.
+func NewGradientWallpaperGenerator(foreground, from, to color.RGBA, opt WallpaperOptions) WallpaperGenerator {
+	return func(path string, w, h int, pct float64) error {
+		return writeWallpaper(path, drawWallpaper(w, h, pct, foreground, drawGradient(w, h, from, to), opt), opt)
+	}
+}
+
+// NewEasedWallpaperGenerator returns a generator that draws with generator
+// after mapping the fraction completed through ease.
+func NewEasedWallpaperGenerator(generator WallpaperGenerator, ease Easing) WallpaperGenerator {
+	return func(path string, w, h int, pct float64) error {
+		return generator(path, w, h, ease(pct))
+	}
+}
+
+// NewRadialWallpaperGenerator returns a generator that grows a circle of the
+// foreground color outward from the center of the background. The circle
+// reaches the corners of the image when pct is 1.
+func NewRadialWallpaperGenerator(foreground, background color.RGBA, opt WallpaperOptions) WallpaperGenerator {
+	return func(path string, w, h int, pct float64) error {
+		m := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(m, m.Bounds(), &image.Uniform{background}, image.ZP, draw.Src)
+
+		center := image.Pt(w/2, h/2)
+		r := pct * math.Hypot(float64(w)/2, float64(h)/2)
+		draw.DrawMask(m, m.Bounds(), &image.Uniform{foreground}, image.ZP, &circle{center, r}, image.ZP, draw.Over)
+
+		if opt.Watermark != nil {
+			drawWatermark(m, opt.Watermark, opt.WatermarkPosition)
 		}
+		return writeWallpaper(path, m, opt)
+	}
+}
 
-		// Create image with the foreground color covering a percentage of the background.
+// NewTomatoCountGenerator returns a generator that draws a row of total
+// tomatoes across the middle of the background. The number returned by
+// completed are drawn filled with the foreground color and the rest are drawn
+// as outlines. The step's pct is not used.
+func NewTomatoCountGenerator(completed func() int, total int, foreground, background color.RGBA, opt WallpaperOptions) WallpaperGenerator {
+	return func(path string, w, h int, pct float64) error {
 		m := image.NewRGBA(image.Rect(0, 0, w, h))
-		draw.Draw(m, m.Bounds(), &image.Uniform{bg}, image.ZP, draw.Over)
-		draw.Draw(m, image.Rect(0, 0, w, int(float64(h)*pct)), &image.Uniform{fg}, image.Point{X: 0, Y: int(float64(h) * (1.0 - pct))}, draw.Over)
+		draw.Draw(m, m.Bounds(), &image.Uniform{background}, image.ZP, draw.Src)
 
-		// Open output file.
-		f, err := os.Create(path)
-		if err != nil {
-			return err
+		if total > 0 {
+			// Center each tomato within an equal share of the width.
+			cell := w / total
+			r := 0.4 * math.Min(float64(cell), float64(h))
+			thickness := math.Max(r/4, 1)
+			n := completed()
+			for k := 0; k < total; k++ {
+				center := image.Pt(cell*k+cell/2, h/2)
+				draw.DrawMask(m, m.Bounds(), &image.Uniform{foreground}, image.ZP, &circle{center, r}, image.ZP, draw.Over)
+				if k >= n {
+					draw.DrawMask(m, m.Bounds(), &image.Uniform{background}, image.ZP, &circle{center, r - thickness}, image.ZP, draw.Over)
+				}
+			}
 		}
-		defer func() { _ = f.Close() }()
 
-		// Encode to file.
+		if opt.Watermark != nil {
+			drawWatermark(m, opt.Watermark, opt.WatermarkPosition)
+		}
+		return writeWallpaper(path, m, opt)
+	}
+}
+
+// NewImageWallpaperGenerator returns a generator that stretches the image to
+// cover the wallpaper and overlays the foreground color covering pct percent
+// of the image.
+func NewImageWallpaperGenerator(foreground color.RGBA, background image.Image, opt WallpaperOptions) WallpaperGenerator {
+	return func(path string, w, h int, pct float64) error {
+		bg := &scaledImage{Image: background, w: w, h: h}
+		return writeWallpaper(path, drawWallpaper(w, h, pct, foreground, bg, opt), opt)
+	}
+}
+
+// circle is an alpha mask that is opaque within radius r of the center.
+type circle struct {
+	p image.Point
+	r float64
+}
+
+func (c *circle) ColorModel() color.Model { return color.AlphaModel }
+
+func (c *circle) Bounds() image.Rectangle {
+	r := int(math.Ceil(c.r))
+	return image.Rect(c.p.X-r, c.p.Y-r, c.p.X+r, c.p.Y+r)
+}
+
+func (c *circle) At(x, y int) color.Color {
+	if math.Hypot(float64(x-c.p.X)+0.5, float64(y-c.p.Y)+0.5) < c.r {
+		return color.Alpha{255}
+	}
+	return color.Alpha{0}
+}
+
+// scaledImage stretches an image to w by h using nearest-neighbor sampling.
+type scaledImage struct {
+	image.Image
+	w, h int
+}
+
+func (m *scaledImage) Bounds() image.Rectangle { return image.Rect(0, 0, m.w, m.h) }
+
+func (m *scaledImage) At(x, y int) color.Color {
+	b := m.Image.Bounds()
+	return m.Image.At(b.Min.X+x*b.Dx()/m.w, b.Min.Y+y*b.Dy()/m.h)
+}
+
+// drawGradient returns an image that blends from the top color to the
+// bottom color by interpolating each channel across the height.
+func drawGradient(w, h int, from, to color.Color) *image.RGBA {
+	m := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		var pct float64
+		if h > 1 {
+			pct = float64(y) / float64(h-1)
+		}
+		draw.Draw(m, image.Rect(0, y, w, y+1), &image.Uniform{TransposeColor(from, to, pct)}, image.ZP, draw.Src)
+	}
+	return m
+}
+
+// LerpPalette returns the color pct percent of the way through the palette.
+// Colors are linearly interpolated between adjacent palette entries.
+func LerpPalette(palette []color.RGBA, pct float64) color.Color {
+	switch len(palette) {
+	case 0:
+		return color.Transparent
+	case 1:
+		return palette[0]
+	}
+
+	// Determine the segment of the palette and the position within it.
+	pos := math.Min(math.Max(pct, 0), 1) * float64(len(palette)-1)
+	i := int(pos)
+	if i >= len(palette)-1 {
+		return palette[len(palette)-1]
+	}
+	return TransposeColor(palette[i], palette[i+1], pos-float64(i))
+}
+
+// drawWallpaper returns an image with the foreground color covering pct
+// percent of the background image, drawn using the given options.
+func drawWallpaper(w, h int, pct float64, fg color.Color, bg image.Image, opt WallpaperOptions) *image.RGBA {
+	m := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(m, m.Bounds(), bg, image.ZP, draw.Over)
+
+	var r image.Rectangle
+	switch opt.Direction {
+	case FillBottom:
+		r = image.Rect(0, h-int(float64(h)*pct), w, h)
+	case FillLeft:
+		r = image.Rect(0, 0, int(float64(w)*pct), h)
+	case FillRight:
+		r = image.Rect(w-int(float64(w)*pct), 0, w, h)
+	default:
+		r = image.Rect(0, 0, w, int(float64(h)*pct))
+	}
+	draw.Draw(m, r, &image.Uniform{fg}, image.Point{X: 0, Y: int(float64(h) * (1.0 - pct))}, draw.Over)
+
+	// Draw the divider on the background side of the foreground's edge.
+	if opt.DividerColor != nil && !r.Empty() && r != m.Bounds() {
+		drawDivider(m, r, opt)
+	}
+
+	if opt.Watermark != nil {
+		drawWatermark(m, opt.Watermark, opt.WatermarkPosition)
+	}
+	return m
+}
+
+// drawDivider draws a line of the divider color adjacent to the inner edge of
+// the foreground rectangle r.
+func drawDivider(m *image.RGBA, r image.Rectangle, opt WallpaperOptions) {
+	width := opt.DividerWidth
+	if width <= 0 {
+		width = DefaultDividerWidth
+	}
+
+	b := m.Bounds()
+	var line image.Rectangle
+	switch opt.Direction {
+	case FillBottom:
+		line = image.Rect(b.Min.X, r.Min.Y-width, b.Max.X, r.Min.Y)
+	case FillLeft:
+		line = image.Rect(r.Max.X, b.Min.Y, r.Max.X+width, b.Max.Y)
+	case FillRight:
+		line = image.Rect(r.Min.X-width, b.Min.Y, r.Min.X, b.Max.Y)
+	default:
+		line = image.Rect(b.Min.X, r.Max.Y, b.Max.X, r.Max.Y+width)
+	}
+	draw.Draw(m, line, &image.Uniform{opt.DividerColor}, image.ZP, draw.Over)
+}
+
+// drawWatermark composites wm over the corner of m given by pos.
+func drawWatermark(m *image.RGBA, wm image.Image, pos WatermarkPosition) {
+	size := wm.Bounds().Size()
+	left, top := WatermarkPadding, WatermarkPadding
+	right, bottom := m.Bounds().Dx()-size.X-WatermarkPadding, m.Bounds().Dy()-size.Y-WatermarkPadding
+
+	var pt image.Point
+	switch pos {
+	case WatermarkBottomLeft:
+		pt = image.Pt(left, bottom)
+	case WatermarkTopRight:
+		pt = image.Pt(right, top)
+	case WatermarkTopLeft:
+		pt = image.Pt(left, top)
+	default:
+		pt = image.Pt(right, bottom)
+	}
+	draw.Draw(m, image.Rectangle{Min: pt, Max: pt.Add(size)}, wm, wm.Bounds().Min, draw.Over)
+}
+
+// writeWallpaper encodes m to path. The image is encoded as a JPEG if path
+// has a ".jpg" or ".jpeg" extension. Otherwise it is encoded as a PNG.
+func writeWallpaper(path string, m image.Image, opt WallpaperOptions) error {
+	// Ensure the parent directory exists.
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return fmt.Errorf("mkdir: %s", err)
+	}
+
+	// Open output file.
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	// Encode to file.
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg":
+		quality := opt.Quality
+		if quality == 0 {
+			quality = jpeg.DefaultQuality
+		}
+		if err := jpeg.Encode(f, m, &jpeg.Options{Quality: quality}); err != nil {
+			return fmt.Errorf("jpeg encode: %s", err)
+		}
+	default:
 		if err := png.Encode(f, m); err != nil {
 			return fmt.Errorf("png encode: %s", err)
 		}
+	}
 
-		return nil
-	}, nil
+	return nil
 }
 
 // normalizeTime removes the year, month, day components of a time.
@@ -164,25 +895,182 @@ tell application "Finder"
 end tell
 `
 
+// FixedDesktopSize returns a DesktopSizer that always returns w by h without
+// querying the display. This is useful for headless machines or when a
+// deterministic wallpaper size is wanted.
+func FixedDesktopSize(w, h int) DesktopSizer {
+	return func(exec CommandExecutor) (int, int, error) {
+		return w, h, nil
+	}
+}
+
+// ScaleDesktopSizer returns a DesktopSizer that multiplies the size returned
+// by sizer by scale. This is used to convert points to pixels on HiDPI displays.
+// Because the cached wallpaper filename includes the size, images generated at
+// one scale are not reused at another.
+func ScaleDesktopSizer(sizer DesktopSizer, scale float64) DesktopSizer {
+	return func(exec CommandExecutor) (w, h int, err error) {
+		if w, h, err = sizer(exec); err != nil {
+			return 0, 0, err
+		}
+		return int(float64(w) * scale), int(float64(h) * scale), nil
+	}
+}
+
+// AutoScaleDesktopSizer returns a DesktopSizer that multiplies the size returned
+// by sizer by the backing scale factor of the main display.
+func AutoScaleDesktopSizer(sizer DesktopSizer) DesktopSizer {
+	return func(exec CommandExecutor) (w, h int, err error) {
+		scale, err := BackingScaleFactor(exec)
+		if err != nil {
+			return 0, 0, fmt.Errorf("backing scale factor: %s", err)
+		}
+		return ScaleDesktopSizer(sizer, scale)(exec)
+	}
+}
+
+// BackingScaleFactor returns the ratio of pixels to points on the main display.
+func BackingScaleFactor(exec CommandExecutor) (float64, error) {
+	b, err := exec(OSAScriptPath, []string{"-l", "JavaScript"}, strings.NewReader(strings.TrimSpace(backingScaleFactorScript)))
+	if err != nil {
+		return 0, fmt.Errorf("exec: %s", b)
+	}
+
+	scale, err := strconv.ParseFloat(strings.TrimSpace(string(b)), 64)
+	if err != nil || scale <= 0 {
+		return 0, fmt.Errorf("unexpected exec output: %s", b)
+	}
+	return scale, nil
+}
+
+const backingScaleFactorScript = `
+ObjC.import('AppKit');
+$.NSScreen.mainScreen.backingScaleFactor;
+`
+
+// DesktopSizes returns the bounds of each attached display.
+// The primary display is always returned first.
+func DesktopSizes(exec CommandExecutor) ([]image.Rectangle, error) {
+	b, err := exec(OSAScriptPath, []string{"-l", "JavaScript"}, strings.NewReader(strings.TrimSpace(desktopSizesScript)))
+	if err != nil {
+		return nil, fmt.Errorf("exec: %s", b)
+	}
+
+	// Parse the bounds of each display from its own line.
+	var a []image.Rectangle
+	re := regexp.MustCompile(`^(-?\d+), (-?\d+), (\d+), (\d+)$`)
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		m := re.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			return nil, fmt.Errorf("unexpected exec output: %s", b)
+		}
+
+		x, _ := strconv.Atoi(m[1])
+		y, _ := strconv.Atoi(m[2])
+		w, _ := strconv.Atoi(m[3])
+		h, _ := strconv.Atoi(m[4])
+		a = append(a, image.Rect(x, y, x+w, y+h))
+	}
+	return a, nil
+}
+
+// PrimaryDesktopSize returns the size of the primary display.
+// Unlike DesktopSize, it does not include the area of other attached displays.
+func PrimaryDesktopSize(exec CommandExecutor) (w, h int, err error) {
+	a, err := DesktopSizes(exec)
+	if err != nil {
+		return 0, 0, err
+	}
+	return a[0].Dx(), a[0].Dy(), nil
+}
+
+// desktopSizesScript prints the frame of each display on a separate line.
+const desktopSizesScript = `
+ObjC.import('AppKit');
+$.NSScreen.screens.js.map(function(s) {
+  var f = s.frame;
+  return [f.origin.x, f.origin.y, f.size.width, f.size.height].join(', ');
+}).join('\n');
+`
+
 // NewMenuBarHandler returns a handler for flashing the menu bar.
 func NewMenuBarHandler(exec CommandExecutor) Handler {
+	return NewMenuBarHandlerWithFlash(exec, DefaultMenuBarFlash)
+}
+
+// MenuBarFlashFunc returns the number of times to flash the menu bar and the
+// delay between each change of appearance for a given progress through the
+// interval, from 0 to 1.
+type MenuBarFlashFunc func(pct float64) (count int, delay time.Duration)
+
+// DefaultMenuBarFlash flashes the menu bar for 30 seconds regardless of progress.
+func DefaultMenuBarFlash(pct float64) (count int, delay time.Duration) {
+	return 30, 500 * time.Millisecond
+}
+
+// UrgentMenuBarFlash flashes like DefaultMenuBarFlash but flashes twice as
+// fast during the last 20% of the interval.
+func UrgentMenuBarFlash(pct float64) (count int, delay time.Duration) {
+	if pct >= 0.8 {
+		return 60, 250 * time.Millisecond
+	}
+	return DefaultMenuBarFlash(pct)
+}
+
+// NewMenuBarHandlerWithFlash returns a handler for flashing the menu bar where
+// the number of flashes & their speed is determined by fn.
+func NewMenuBarHandlerWithFlash(exec CommandExecutor, fn MenuBarFlashFunc) Handler {
 	return func(i, n int) error {
+		count, delay := fn(Percent(i, n))
+
 		// Flash menu bar.
-		if b, err := exec(OSAScriptPath, nil, strings.NewReader(strings.TrimSpace(flashDarkModeScript))); err != nil {
+		src := fmt.Sprintf(strings.TrimSpace(flashDarkModeScript), count, delay.Seconds(), delay.Seconds())
+		if b, err := exec(OSAScriptPath, nil, strings.NewReader(src)); err != nil {
 			return fmt.Errorf("exec flash: %s", b)
 		}
 		return nil
 	}
 }
 
-// flashDarkModeScript flashes the menu bar on and off for 30 seconds.
+// flashDarkModeScript flashes the menu bar on and off a number of times.
 const flashDarkModeScript = `
 tell application "System Events"
   tell appearance preferences
-    repeat 30 times
+    repeat %d times
       set dark mode to true
-      delay 0.5
+      delay %g
       set dark mode to false
+      delay %g
+    end repeat
+  end tell
+end tell
+`
+
+// NewMenuBarFlashHandler returns a handler that briefly flashes the menu bar
+// on the first step of each interval. Other steps are ignored and the user's
+// appearance setting is restored after flashing.
+func NewMenuBarFlashHandler(exec CommandExecutor) Handler {
+	return func(i, n int) error {
+		if i != 0 {
+			return nil
+		}
+		if b, err := exec(OSAScriptPath, nil, strings.NewReader(strings.TrimSpace(flashDarkModeOnceScript))); err != nil {
+			return fmt.Errorf("exec flash: %s", b)
+		}
+		return nil
+	}
+}
+
+// flashDarkModeOnceScript flashes the menu bar 5 times and then restores the
+// original appearance.
+const flashDarkModeOnceScript = `
+tell application "System Events"
+  tell appearance preferences
+    set originalDarkMode to dark mode
+    repeat 5 times
+      set dark mode to not originalDarkMode
+      delay 0.5
+      set dark mode to originalDarkMode
       delay 0.5
     end repeat
   end tell
@@ -191,8 +1079,43 @@ end tell
 
 // NewAnnouncementHandler returns a handler for announcing the current time.
 func NewAnnouncementHandler(exec CommandExecutor) Handler {
+	return NewAnnouncementHandlerWithOptions(exec, AnnouncementOptions{})
+}
+
+// AnnouncementOptions represents optional settings for announcements.
+type AnnouncementOptions struct {
+	// Text displayed below the title of the notification.
+	Subtitle string
+
+	// Name of a sound played with the notification, such as "Glass". Sounds
+	// are found in ~/Library/Sounds and /System/Library/Sounds.
+	Sound string
+
+	// Layout used to format the current time. Defaults to
+	// DefaultAnnouncementTimeFormat.
+	TimeFormat string
+}
+
+// DefaultAnnouncementTimeFormat is the default layout of announced times.
+const DefaultAnnouncementTimeFormat = "3:04pm"
+
+// NewAnnouncementHandlerWithOptions returns a handler for announcing the
+// current time with a notification customized by opt.
+func NewAnnouncementHandlerWithOptions(exec CommandExecutor, opt AnnouncementOptions) Handler {
+	layout := opt.TimeFormat
+	if layout == "" {
+		layout = DefaultAnnouncementTimeFormat
+	}
+
 	return func(i, n int) error {
-		src := fmt.Sprintf(displayNotificationScript, time.Now().Format("3:04pm"))
+		src := fmt.Sprintf(displayNotificationScript, escapeAppleScriptString(time.Now().Format(layout)))
+		if opt.Subtitle != "" {
+			src += fmt.Sprintf(` subtitle "%s"`, escapeAppleScriptString(opt.Subtitle))
+		}
+		if opt.Sound != "" {
+			src += fmt.Sprintf(` sound name "%s"`, escapeAppleScriptString(opt.Sound))
+		}
+
 		if b, err := exec(OSAScriptPath, nil, strings.NewReader(src)); err != nil {
 			return fmt.Errorf("exec display notification: %s", b)
 		}
@@ -200,4 +1123,482 @@ func NewAnnouncementHandler(exec CommandExecutor) Handler {
 	}
 }
 
-const displayNotificationScript = `display notification %q with title "Boxer"`
+const displayNotificationScript = `display notification "%s" with title "Boxer"`
+
+// escapeAppleScriptString escapes s for use between double quotes in an
+// AppleScript string literal.
+func escapeAppleScriptString(s string) string {
+	return appleScriptStringReplacer.Replace(s)
+}
+
+var appleScriptStringReplacer = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\t", `\t`,
+)
+
+// SayPath is the path to the "say" binary.
+const SayPath = `/usr/bin/say`
+
+// NewSpeechHandler returns a handler that speaks text aloud at the start of
+// each interval. The "{time}" placeholder in text is replaced with the current
+// time. If voice is blank then the system voice is used.
+func NewSpeechHandler(exec CommandExecutor, text, voice string) Handler {
+	return func(i, n int) error {
+		if i != 0 {
+			return nil
+		}
+
+		var args []string
+		if voice != "" {
+			args = append(args, "-v", voice)
+		}
+		args = append(args, strings.Replace(text, "{time}", time.Now().Format("3:04pm"), -1))
+
+		if b, err := exec(SayPath, args, nil); err != nil {
+			return fmt.Errorf("exec say: %s", b)
+		}
+		return nil
+	}
+}
+
+// NewCountdownHandler returns a handler that announces the time remaining in
+// the interval when it matches one of the thresholds in at, such as
+// "5 minutes remaining". The step duration is used to compute the time left.
+func NewCountdownHandler(exec CommandExecutor, step time.Duration, at []time.Duration) Handler {
+	return func(i, n int) error {
+		remaining := RemainingTime(i, n, step)
+		for _, d := range at {
+			if d != remaining {
+				continue
+			}
+
+			src := fmt.Sprintf(displayNotificationScript, escapeAppleScriptString(FormatCountdown(remaining)))
+			if b, err := exec(OSAScriptPath, nil, strings.NewReader(src)); err != nil {
+				return fmt.Errorf("exec display notification: %s", b)
+			}
+			return nil
+		}
+		return nil
+	}
+}
+
+// FormatCountdown returns the remaining time as a phrase, such as "5 minutes remaining".
+func FormatCountdown(d time.Duration) string {
+	switch {
+	case d == time.Minute:
+		return "1 minute remaining"
+	case d > time.Minute:
+		return fmt.Sprintf("%d minutes remaining", int(d.Minutes()))
+	case d == time.Second:
+		return "1 second remaining"
+	default:
+		return fmt.Sprintf("%d seconds remaining", int(d.Seconds()))
+	}
+}
+
+// NewScreenFlashHandler returns a handler for flashing the screen with a solid
+// color on the final step of each interval. The flash is skipped if the
+// frontmost application is in full screen mode.
+func NewScreenFlashHandler(exec CommandExecutor, c color.RGBA, duration time.Duration) Handler {
+	return func(i, n int) error {
+		// Only flash on the last step of the interval.
+		if i != n-1 {
+			return nil
+		}
+
+		// Skip the flash if a full screen application is active.
+		b, err := exec(OSAScriptPath, nil, strings.NewReader(strings.TrimSpace(fullScreenScript)))
+		if err != nil {
+			return fmt.Errorf("exec full screen: %s", b)
+		} else if strings.TrimSpace(string(b)) == "true" {
+			return nil
+		}
+
+		// Display a borderless window covering the main screen.
+		src := fmt.Sprintf(strings.TrimSpace(flashScreenScript),
+			float64(c.R)/0xFF, float64(c.G)/0xFF, float64(c.B)/0xFF, float64(c.A)/0xFF,
+			duration.Seconds(),
+		)
+		if b, err := exec(OSAScriptPath, []string{"-l", "JavaScript"}, strings.NewReader(src)); err != nil {
+			return fmt.Errorf("exec flash screen: %s", b)
+		}
+		return nil
+	}
+}
+
+// fullScreenScript returns "true" if the frontmost window is in full screen mode.
+const fullScreenScript = `
+tell application "System Events"
+  set frontApp to first application process whose frontmost is true
+  try
+    return value of attribute "AXFullScreen" of window 1 of frontApp
+  on error
+    return false
+  end try
+end tell
+`
+
+// flashScreenScript displays a borderless, colored window over the main
+// screen for a number of seconds. It is written in JavaScript for Automation
+// since AppleScript cannot create windows directly.
+const flashScreenScript = `
+ObjC.import('Cocoa');
+var win = $.NSWindow.alloc.initWithContentRectStyleMaskBackingDefer(
+  $.NSScreen.mainScreen.frame, $.NSBorderlessWindowMask, $.NSBackingStoreBuffered, false
+);
+win.backgroundColor = $.NSColor.colorWithCalibratedRedGreenBlueAlpha(%f, %f, %f, %f);
+win.level = $.NSScreenSaverWindowLevel;
+win.makeKeyAndOrderFront(null);
+delay(%f);
+win.close;
+`
+
+// StatusIconSize is the width & height of the generated status icon.
+const StatusIconSize = 32
+
+// NewStatusIconHandler returns a handler for writing a small status icon to path.
+// The icon is rendered with the same generator as the wallpaper so it can be
+// embedded elsewhere, such as a web dashboard.
+func NewStatusIconHandler(generator WallpaperGenerator, path string) Handler {
+	return func(i, n int) error {
+		if err := generator(path, StatusIconSize, StatusIconSize, Percent(i, n)); err != nil {
+			return fmt.Errorf("generate status icon: %s", err)
+		}
+		return nil
+	}
+}
+
+// NewNightShiftHandler returns a handler for ramping the Night Shift strength
+// as the interval progresses. The strength is only changed while the schedule
+// is active, which usually crosses midnight, such as from 7:00pm to 7:00am.
+func NewNightShiftHandler(exec CommandExecutor, now NowFunc, schedule *Schedule) Handler {
+	return func(i, n int) error {
+		// Ignore steps that occur outside the scheduled time of day.
+		if !schedule.Active(now()) {
+			return nil
+		}
+
+		// Clamp the strength between 0 and 1.
+		strength := math.Min(math.Max(Percent(i, n), 0), 1)
+
+		src := fmt.Sprintf(strings.TrimSpace(nightShiftStrengthScript), strength)
+		if b, err := exec(OSAScriptPath, []string{"-l", "JavaScript"}, strings.NewReader(src)); err != nil {
+			return fmt.Errorf("exec night shift: %s", b)
+		}
+		return nil
+	}
+}
+
+// nightShiftStrengthScript enables Night Shift and sets its strength using the
+// private CoreBrightness framework.
+const nightShiftStrengthScript = `
+ObjC.import('Foundation');
+$.NSBundle.bundleWithPath('/System/Library/PrivateFrameworks/CoreBrightness.framework').load;
+var client = $.CBBlueLightClient.alloc.init;
+client.setStrengthCommit(%f, true);
+client.setEnabled(true);
+`
+
+// IORegPath is the path to the "ioreg" binary.
+const IORegPath = `/usr/sbin/ioreg`
+
+// TouchBarHelperPath is the path to the helper that draws progress on the
+// Touch Bar. It is passed the progress percent as a single argument.
+const TouchBarHelperPath = `/usr/local/bin/boxer-touchbar`
+
+// KillallPath is the path to the "killall" binary.
+const KillallPath = `/usr/bin/killall`
+
+// DesktopIconsHandler hides the desktop icons during each interval. Icons are
+// hidden on the first step and shown again on the final step, so the
+// command's step must be smaller than its interval.
+type DesktopIconsHandler struct {
+	// The function used to execute OS commands.
+	Exec CommandExecutor
+
+	disabled bool // true if icons were already hidden by the user
+	hidden   bool // true if the handler has hidden the icons
+}
+
+// NewDesktopIconsHandler returns a handler that hides the desktop icons
+// during each interval.
+func NewDesktopIconsHandler(exec CommandExecutor) Handler {
+	h := &DesktopIconsHandler{Exec: exec}
+	return h.Handle
+}
+
+// Handle hides the icons on the first step and shows them on the final step.
+func (h *DesktopIconsHandler) Handle(i, n int) error {
+	if h.disabled {
+		return nil
+	}
+
+	switch {
+	case i == n-1:
+		if h.hidden {
+			return h.setVisible(true)
+		}
+	case i == 0:
+		return h.setVisible(false)
+	}
+	return nil
+}
+
+// Capture checks whether the user already hides desktop icons, in which case
+// the handler leaves them alone.
+func (h *DesktopIconsHandler) Capture() error {
+	b, err := h.Exec(DefaultsPath, []string{"read", "com.apple.finder", "CreateDesktop"}, nil)
+	if err != nil {
+		return nil // setting is unset, which shows icons
+	}
+	switch strings.ToLower(string(bytes.TrimSpace(b))) {
+	case "0", "false", "no":
+		h.disabled = true
+	}
+	return nil
+}
+
+// Restore shows the desktop icons if the handler hid them.
+func (h *DesktopIconsHandler) Restore() error {
+	if !h.hidden {
+		return nil
+	}
+	return h.setVisible(true)
+}
+
+// setVisible writes the Finder setting and restarts Finder to apply it.
+func (h *DesktopIconsHandler) setVisible(v bool) error {
+	if b, err := h.Exec(DefaultsPath, []string{"write", "com.apple.finder", "CreateDesktop", "-bool", strconv.FormatBool(v)}, nil); err != nil {
+		return fmt.Errorf("exec defaults: %s", b)
+	} else if b, err := h.Exec(KillallPath, []string{"Finder"}, nil); err != nil {
+		return fmt.Errorf("exec killall: %s", b)
+	}
+	h.hidden = !v
+	return nil
+}
+
+// NewTouchBarHandler returns a handler that draws the progress of each step
+// on the Touch Bar. The handler checks for a Touch Bar on its first call and
+// does nothing if one is not present.
+func NewTouchBarHandler(exec CommandExecutor) Handler {
+	var detected, present bool
+	return func(i, n int) error {
+		// Detect the Touch Bar once. Machines without one do not register
+		// the embedded OS host that drives it.
+		if !detected {
+			b, err := exec(IORegPath, []string{"-c", "AppleEmbeddedOSSupportHost"}, nil)
+			present = err == nil && len(bytes.TrimSpace(b)) > 0
+			detected = true
+		}
+		if !present {
+			return nil
+		}
+
+		pct := Percent(i, n)
+		if b, err := exec(TouchBarHelperPath, []string{strconv.FormatFloat(pct, 'f', 4, 64)}, nil); err != nil {
+			return fmt.Errorf("exec touch bar: %s", b)
+		}
+		return nil
+	}
+}
+
+// MenuBarAutohideHandler auto-hides the menu bar during each interval. The
+// menu bar is hidden on the first step and shown again on the final step, so
+// the command's step must be smaller than its interval.
+type MenuBarAutohideHandler struct {
+	// The function used to execute OS commands.
+	Exec CommandExecutor
+
+	disabled bool // true if the menu bar was already hidden by the user
+	hidden   bool // true if the handler has hidden the menu bar
+}
+
+// NewMenuBarAutohideHandler returns a handler that auto-hides the menu bar
+// during each interval.
+func NewMenuBarAutohideHandler(exec CommandExecutor) Handler {
+	h := &MenuBarAutohideHandler{Exec: exec}
+	return h.Handle
+}
+
+// Handle hides the menu bar on the first step and shows it on the final step.
+func (h *MenuBarAutohideHandler) Handle(i, n int) error {
+	if h.disabled {
+		return nil
+	}
+
+	switch {
+	case i == n-1:
+		if h.hidden {
+			return h.setHidden(false)
+		}
+	case i == 0:
+		return h.setHidden(true)
+	}
+	return nil
+}
+
+// Capture checks whether the user already auto-hides the menu bar, in which
+// case the handler leaves it alone.
+func (h *MenuBarAutohideHandler) Capture() error {
+	b, err := h.Exec(DefaultsPath, []string{"read", "NSGlobalDomain", "_HIHideMenuBar"}, nil)
+	if err != nil {
+		return nil // setting is unset, which shows the menu bar
+	}
+	switch strings.ToLower(string(bytes.TrimSpace(b))) {
+	case "1", "true", "yes":
+		h.disabled = true
+	}
+	return nil
+}
+
+// Restore shows the menu bar if the handler hid it.
+func (h *MenuBarAutohideHandler) Restore() error {
+	if !h.hidden {
+		return nil
+	}
+	return h.setHidden(false)
+}
+
+// setHidden writes the global setting and restarts SystemUIServer to apply it.
+func (h *MenuBarAutohideHandler) setHidden(v bool) error {
+	if b, err := h.Exec(DefaultsPath, []string{"write", "NSGlobalDomain", "_HIHideMenuBar", "-bool", strconv.FormatBool(v)}, nil); err != nil {
+		return fmt.Errorf("exec defaults: %s", b)
+	} else if b, err := h.Exec(KillallPath, []string{"SystemUIServer"}, nil); err != nil {
+		return fmt.Errorf("exec killall: %s", b)
+	}
+	h.hidden = v
+	return nil
+}
+
+// NewIdleGate returns a handler that calls inner only while the system has
+// been idle for no longer than threshold, such as to pause while you are away.
+// The idle time is queried on every call. Use an IdleChecker to share a single
+// query between handlers.
+func NewIdleGate(exec CommandExecutor, threshold time.Duration, inner Handler) Handler {
+	return idleGate(func() (bool, error) { return isIdle(exec, threshold) }, inner)
+}
+
+// idleGate returns a handler that calls inner only while idle returns false.
+func idleGate(idle func() (bool, error), inner Handler) Handler {
+	return func(i, n int) error {
+		if v, err := idle(); err != nil {
+			return fmt.Errorf("idle time: %s", err)
+		} else if v {
+			return nil
+		}
+		return inner(i, n)
+	}
+}
+
+// IdleChecker reports whether the system has been idle for longer than a
+// threshold. The idle time is queried once and reused until Reset is called,
+// such as at the start of every tick, so that all handlers gated by the
+// checker share a single query.
+type IdleChecker struct {
+	mu        sync.Mutex
+	exec      CommandExecutor
+	threshold time.Duration
+	checked   bool // true if idle & err hold the current result
+	idle      bool
+	err       error
+}
+
+// NewIdleChecker returns a new instance of IdleChecker.
+func NewIdleChecker(exec CommandExecutor, threshold time.Duration) *IdleChecker {
+	return &IdleChecker{exec: exec, threshold: threshold}
+}
+
+// Reset discards the previous result so the next check queries the idle time.
+func (c *IdleChecker) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checked = false
+}
+
+// Idle returns true if the system has been idle for longer than the threshold.
+func (c *IdleChecker) Idle() (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.checked {
+		c.idle, c.err = isIdle(c.exec, c.threshold)
+		c.checked = true
+	}
+	return c.idle, c.err
+}
+
+// Gate returns a handler that calls inner only while the system is not idle.
+func (c *IdleChecker) Gate(inner Handler) Handler {
+	return idleGate(c.Idle, inner)
+}
+
+// isIdle returns true if the system has been idle for longer than threshold.
+func isIdle(exec CommandExecutor, threshold time.Duration) (bool, error) {
+	idle, err := IdleTime(exec)
+	if err != nil {
+		return false, err
+	}
+	return idle > threshold, nil
+}
+
+// IdleTime returns the time since the last keyboard or mouse input.
+func IdleTime(exec CommandExecutor) (time.Duration, error) {
+	b, err := exec(IORegPath, []string{"-c", "IOHIDSystem", "-d", "4"}, nil)
+	if err != nil {
+		return 0, fmt.Errorf("exec: %s", b)
+	}
+
+	m := idleTimeRegexp.FindSubmatch(b)
+	if m == nil {
+		return 0, fmt.Errorf("HIDIdleTime not found")
+	}
+	ns, err := strconv.ParseInt(string(m[1]), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(ns), nil
+}
+
+var idleTimeRegexp = regexp.MustCompile(`"HIDIdleTime" = (\d+)`)
+
+// DefaultsPath is the path to the "defaults" binary.
+const DefaultsPath = `/usr/bin/defaults`
+
+// NewAccentColorHandler returns a handler that shifts the system highlight
+// color through colors as the interval progresses.
+func NewAccentColorHandler(exec CommandExecutor, colors []color.RGBA) Handler {
+	return func(i, n int) error {
+		if len(colors) == 0 {
+			return nil
+		}
+
+		// Pick the color for the current position, clamped to the last color.
+		index := int(Percent(i, n) * float64(len(colors)))
+		if index >= len(colors) {
+			index = len(colors) - 1
+		}
+		c := colors[index]
+		r, g, b := float64(c.R)/0xFF, float64(c.G)/0xFF, float64(c.B)/0xFF
+
+		// Persist the highlight color and then apply it to the running session.
+		if out, err := exec(DefaultsPath, []string{"write", "-g", "AppleHighlightColor", fmt.Sprintf("%f %f %f Other", r, g, b)}, nil); err != nil {
+			return fmt.Errorf("exec defaults: %s", out)
+		}
+		src := fmt.Sprintf(strings.TrimSpace(setHighlightColorScript), int(c.R)*0x101, int(c.G)*0x101, int(c.B)*0x101)
+		if out, err := exec(OSAScriptPath, nil, strings.NewReader(src)); err != nil {
+			return fmt.Errorf("exec highlight color: %s", out)
+		}
+		return nil
+	}
+}
+
+// setHighlightColorScript sets the highlight color using 16-bit RGB components.
+const setHighlightColorScript = `
+tell application "System Events"
+  tell appearance preferences
+    set highlight color to {%d, %d, %d}
+  end tell
+end tell
+`
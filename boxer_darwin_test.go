@@ -3,10 +3,20 @@ package boxer_test
 import (
 	"bytes"
 	"errors"
+	"fmt"
+	"image"
 	"image/color"
+	"image/draw"
+	"image/png"
 	"io"
 	"io/ioutil"
+	"log"
 	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -56,6 +66,444 @@ func TestWallpaperHandler(t *testing.T) {
 	}
 }
 
+// Ensure the default menu bar handler flashes for 30 seconds.
+func TestMenuBarHandler(t *testing.T) {
+	var script string
+	h := boxer.NewMenuBarHandler(func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		b, _ := ioutil.ReadAll(stdin)
+		script = string(b)
+		return nil, nil
+	})
+	if err := h(0, 1); err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(script, "repeat 30 times") || !strings.Contains(script, "delay 0.5\n") {
+		t.Fatalf("unexpected script:\n\n%s", script)
+	}
+}
+
+// Ensure the urgent menu bar handler flashes more near the end of the interval.
+func TestMenuBarHandler_Urgent(t *testing.T) {
+	var counts []int
+	h := boxer.NewMenuBarHandlerWithFlash(func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		b, _ := ioutil.ReadAll(stdin)
+		m := regexp.MustCompile(`repeat (\d+) times`).FindStringSubmatch(string(b))
+		if m == nil {
+			t.Fatalf("unexpected script:\n\n%s", b)
+		}
+		n, _ := strconv.Atoi(m[1])
+		counts = append(counts, n)
+		return nil, nil
+	}, boxer.UrgentMenuBarFlash)
+
+	for _, i := range []int{0, 5, 9} {
+		if err := h(i, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !reflect.DeepEqual(counts, []int{30, 30, 60}) {
+		t.Fatalf("unexpected counts: %v", counts)
+	}
+}
+
+// Ensure the menu bar flash handler only flashes on the first step.
+func TestMenuBarFlashHandler(t *testing.T) {
+	var scripts []string
+	h := boxer.NewMenuBarFlashHandler(func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		b, _ := ioutil.ReadAll(stdin)
+		scripts = append(scripts, string(b))
+		return nil, nil
+	})
+
+	for i := 0; i < 5; i++ {
+		if err := h(i, 5); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(scripts) != 1 {
+		t.Fatalf("unexpected script count: %d", len(scripts))
+	} else if !strings.Contains(scripts[0], "set dark mode") {
+		t.Fatalf("unexpected script: %s", scripts[0])
+	}
+}
+
+// Ensure that the wallpaper key is included in the cached filename.
+func TestWallpaperHandler_Key(t *testing.T) {
+	var generated string
+	h := &boxer.WallpaperHandler{
+		Exec:      func(name string, args []string, stdin io.Reader) ([]byte, error) { return nil, nil },
+		Sizer:     func(exec boxer.CommandExecutor) (w, h int, err error) { return 100, 200, nil },
+		Generator: func(path string, w, h int, pct float64) error { generated = path; return nil },
+		Path:      "/my/path",
+		Key:       "abc123",
+	}
+
+	if err := h.Handle(1, 10); err != nil {
+		t.Fatal(err)
+	} else if generated != "/my/path/wallpaper_abc123_0100_0200_01_10.png" {
+		t.Fatalf("unexpected path: %s", generated)
+	}
+}
+
+// Ensure the dark generator is used and cached separately in dark mode.
+func TestWallpaperHandler_DarkGenerator(t *testing.T) {
+	appearance := "Dark"
+	var generated []string
+	h := &boxer.WallpaperHandler{
+		Exec: func(name string, args []string, stdin io.Reader) ([]byte, error) {
+			if b, _ := ioutil.ReadAll(stdin); strings.Contains(string(b), "appearance preferences") {
+				return []byte(appearance + "\n"), nil
+			}
+			return nil, nil
+		},
+		Sizer: func(exec boxer.CommandExecutor) (w, h int, err error) { return 100, 200, nil },
+		Generator: func(path string, w, h int, pct float64) error {
+			generated = append(generated, "light "+path)
+			return nil
+		},
+		DarkGenerator: func(path string, w, h int, pct float64) error {
+			generated = append(generated, "dark "+path)
+			return nil
+		},
+		Path: "/my/path",
+	}
+
+	if err := h.Handle(1, 10); err != nil {
+		t.Fatal(err)
+	}
+	appearance = "Light"
+	if err := h.Handle(1, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(generated, []string{
+		"dark /my/path/wallpaper_0100_0200_01_10_dark.png",
+		"light /my/path/wallpaper_0100_0200_01_10.png",
+	}) {
+		t.Fatalf("unexpected generated: %q", generated)
+	}
+}
+
+// Ensure an unexpected appearance returns an error.
+func TestIsDarkMode_ErrUnexpected(t *testing.T) {
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		return []byte("Sepia\n"), nil
+	}
+	if _, err := boxer.IsDarkMode(exec); err == nil || err.Error() != `unexpected appearance: "Sepia"` {
+		t.Fatal(err)
+	}
+}
+
+// Ensure that the wallpaper extension is used in the cached filename.
+func TestWallpaperHandler_Ext(t *testing.T) {
+	var generated string
+	h := &boxer.WallpaperHandler{
+		Exec:      func(name string, args []string, stdin io.Reader) ([]byte, error) { return nil, nil },
+		Sizer:     func(exec boxer.CommandExecutor) (w, h int, err error) { return 100, 200, nil },
+		Generator: func(path string, w, h int, pct float64) error { generated = path; return nil },
+		Path:      "/my/path",
+		Ext:       ".jpg",
+	}
+
+	if err := h.Handle(1, 10); err != nil {
+		t.Fatal(err)
+	} else if generated != "/my/path/wallpaper_0100_0200_01_10.jpg" {
+		t.Fatalf("unexpected path: %s", generated)
+	}
+}
+
+// Ensure the original wallpaper is captured once and restored on shutdown.
+func TestWallpaperHandler_Restore(t *testing.T) {
+	var scripts []string
+	h := &boxer.WallpaperHandler{
+		Exec: func(name string, args []string, stdin io.Reader) ([]byte, error) {
+			b, _ := ioutil.ReadAll(stdin)
+			scripts = append(scripts, string(b))
+			if strings.Contains(string(b), "get POSIX path") {
+				return []byte("/Users/me/Pictures/original.jpg\n"), nil
+			}
+			return nil, nil
+		},
+		Sizer:     func(exec boxer.CommandExecutor) (w, h int, err error) { return 100, 200, nil },
+		Generator: func(path string, w, h int, pct float64) error { return nil },
+		Path:      "/my/path",
+	}
+
+	now := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	ticker := boxer.NewTicker()
+	ticker.Now = func() time.Time { return now }
+	ticker.Commands = append(ticker.Commands, boxer.Command{
+		Step:       1 * time.Minute,
+		Interval:   15 * time.Minute,
+		Handler:    h.Handle,
+		Restorable: h,
+	})
+
+	// Execute two steps and then restore.
+	ticker.Tick()
+	now = now.Add(1 * time.Minute)
+	ticker.Tick()
+	if err := ticker.Restore(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(scripts) != 4 {
+		t.Fatalf("unexpected script count: %d", len(scripts))
+	} else if !strings.Contains(scripts[0], "get POSIX path") {
+		t.Fatalf("unexpected get script: %s", scripts[0])
+	} else if !strings.Contains(scripts[3], `set desktop picture to POSIX file "/Users/me/Pictures/original.jpg"`) {
+		t.Fatalf("unexpected restore script: %s", scripts[3])
+	}
+}
+
+// Ensure the generator is called on every step when caching is disabled.
+func TestWallpaperHandler_DisableCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var paths []string
+	h := &boxer.WallpaperHandler{
+		Exec:  func(name string, args []string, stdin io.Reader) ([]byte, error) { return nil, nil },
+		Sizer: func(exec boxer.CommandExecutor) (w, h int, err error) { return 100, 200, nil },
+		Generator: func(path string, w, h int, pct float64) error {
+			paths = append(paths, path)
+			return ioutil.WriteFile(path, nil, 0666)
+		},
+		Path:         dir,
+		DisableCache: true,
+	}
+
+	for _, i := range []int{1, 1, 2} {
+		if err := h.Handle(i, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Consecutive wallpapers alternate paths so the desktop is refreshed.
+	a, b := filepath.Join(dir, "wallpaper_live_0.png"), filepath.Join(dir, "wallpaper_live_1.png")
+	if !reflect.DeepEqual(paths, []string{a, b, a}) {
+		t.Fatalf("unexpected paths: %v", paths)
+	}
+}
+
+// Ensure uncached wallpapers alternate once per step even when transition
+// frames are generated in between.
+func TestWallpaperHandler_DisableCache_Transition(t *testing.T) {
+	var paths []string
+	h := &boxer.WallpaperHandler{
+		Sizer: func(exec boxer.CommandExecutor) (w, h int, err error) { return 100, 200, nil },
+		Generator: func(path string, w, h int, pct float64) error {
+			paths = append(paths, path)
+			return nil
+		},
+		Path:             "/my/path",
+		Setter:           func(exec boxer.CommandExecutor, path string) error { return nil },
+		DisableCache:     true,
+		TransitionFrames: 1,
+	}
+
+	for _, i := range []int{1, 2} {
+		if err := h.Handle(i, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !reflect.DeepEqual(paths, []string{
+		"/my/path/wallpaper_frame_0.png",
+		"/my/path/wallpaper_live_0.png",
+		"/my/path/wallpaper_frame_0.png",
+		"/my/path/wallpaper_live_1.png",
+	}) {
+		t.Fatalf("unexpected paths: %v", paths)
+	}
+}
+
+// Ensure a custom setter is used to set the wallpaper.
+func TestWallpaperHandler_Setter(t *testing.T) {
+	var paths []string
+	h := &boxer.WallpaperHandler{
+		Sizer:     func(exec boxer.CommandExecutor) (w, h int, err error) { return 100, 200, nil },
+		Generator: func(path string, w, h int, pct float64) error { return nil },
+		Path:      "/my/path",
+		Setter: func(exec boxer.CommandExecutor, path string) error {
+			paths = append(paths, path)
+			return nil
+		},
+	}
+
+	if err := h.Handle(1, 10); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(paths, []string{"/my/path/wallpaper_0100_0200_01_10.png"}) {
+		t.Fatalf("unexpected paths: %v", paths)
+	}
+}
+
+// Ensure intermediate frames are set between steps when transitions are enabled.
+func TestWallpaperHandler_Transition(t *testing.T) {
+	var pcts []float64
+	var paths []string
+	h := &boxer.WallpaperHandler{
+		Sizer: func(exec boxer.CommandExecutor) (w, h int, err error) { return 100, 200, nil },
+		Generator: func(path string, w, h int, pct float64) error {
+			pcts = append(pcts, pct)
+			return nil
+		},
+		Path: "/my/path",
+		Setter: func(exec boxer.CommandExecutor, path string) error {
+			paths = append(paths, path)
+			return nil
+		},
+		TransitionFrames: 3,
+	}
+
+	if err := h.Handle(2, 8); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(pcts, []float64{0.15625, 0.1875, 0.21875, 0.25}) {
+		t.Fatalf("unexpected pcts: %v", pcts)
+	} else if !reflect.DeepEqual(paths, []string{
+		"/my/path/wallpaper_frame_0.png",
+		"/my/path/wallpaper_frame_1.png",
+		"/my/path/wallpaper_frame_0.png",
+		"/my/path/wallpaper_0100_0200_02_08.png",
+	}) {
+		t.Fatalf("unexpected paths: %v", paths)
+	}
+
+	// The first step of an interval is not animated.
+	pcts, paths = nil, nil
+	if err := h.Handle(0, 8); err != nil {
+		t.Fatal(err)
+	} else if len(pcts) != 1 || len(paths) != 1 {
+		t.Fatalf("unexpected frames: %v", paths)
+	}
+}
+
+// Ensure the lock screen backs up the original image, copies each image and
+// logs a single warning after a failure.
+func TestLockScreen(t *testing.T) {
+	var calls [][]string
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		calls = append(calls, append([]string{name}, args...))
+		if len(calls) > 3 {
+			return []byte("sudo: a password is required\n"), errors.New("exit status 1")
+		}
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	l := boxer.NewLockScreen(log.New(&buf, "", 0))
+
+	// The first two copies succeed and the third fails.
+	l.Set(exec, "/tmp/a.png")
+	l.Set(exec, "/tmp/b.png")
+	l.Set(exec, "/tmp/c.png")
+	l.Set(exec, "/tmp/d.png")
+
+	if !reflect.DeepEqual(calls, [][]string{
+		{boxer.SudoPath, "-n", "cp", boxer.LockScreenPath, boxer.LockScreenBackupPath},
+		{boxer.SudoPath, "-n", "cp", "/tmp/a.png", boxer.LockScreenPath},
+		{boxer.SudoPath, "-n", "cp", "/tmp/b.png", boxer.LockScreenPath},
+		{boxer.SudoPath, "-n", "cp", "/tmp/c.png", boxer.LockScreenPath},
+	}) {
+		t.Fatalf("unexpected calls: %q", calls)
+	} else if buf.String() != "lock screen disabled: sudo: a password is required\n" {
+		t.Fatalf("unexpected log: %q", buf.String())
+	}
+}
+
+// Ensure the wallpaper handler restores the original lock screen image.
+func TestWallpaperHandler_Restore_LockScreen(t *testing.T) {
+	var calls [][]string
+	h := &boxer.WallpaperHandler{
+		Exec: func(name string, args []string, stdin io.Reader) ([]byte, error) {
+			if name == boxer.SudoPath {
+				calls = append(calls, append([]string{name}, args...))
+			}
+			return nil, nil
+		},
+		Sizer:        func(exec boxer.CommandExecutor) (w, h int, err error) { return 100, 200, nil },
+		Generator:    func(path string, w, h int, pct float64) error { return nil },
+		Path:         "/my/path",
+		DisableCache: true,
+		LockScreen:   boxer.NewLockScreen(log.New(ioutil.Discard, "", 0)),
+	}
+
+	if err := h.Handle(0, 4); err != nil {
+		t.Fatal(err)
+	} else if err := h.Restore(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(calls) != 3 {
+		t.Fatalf("unexpected calls: %q", calls)
+	} else if !reflect.DeepEqual(calls[0], []string{boxer.SudoPath, "-n", "cp", boxer.LockScreenPath, boxer.LockScreenBackupPath}) {
+		t.Fatalf("unexpected backup: %q", calls[0])
+	} else if calls[1][2] != "cp" || !strings.HasPrefix(calls[1][3], "/my/path/") || calls[1][4] != boxer.LockScreenPath {
+		t.Fatalf("unexpected copy: %q", calls[1])
+	} else if !reflect.DeepEqual(calls[2], []string{boxer.SudoPath, "-n", "mv", boxer.LockScreenBackupPath, boxer.LockScreenPath}) {
+		t.Fatalf("unexpected restore: %q", calls[2])
+	}
+}
+
+// Ensure special characters in the wallpaper path are escaped in the script.
+func TestWallpaperHandler_EscapePath(t *testing.T) {
+	var script string
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		b, _ := ioutil.ReadAll(stdin)
+		script = string(b)
+		return nil, nil
+	}
+	sizer := func(exec boxer.CommandExecutor) (w, h int, err error) { return 100, 200, nil }
+	generator := func(path string, w, h int, pct float64) error { return nil }
+
+	h := boxer.NewWallpaperHandler(exec, sizer, generator, "/my/\"quoted\"\\path\n")
+	if err := h(1, 10); err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(script, `set desktop picture to POSIX file "/my/\"quoted\"\\path\n/wallpaper_0100_0200_01_10.png"`) {
+		t.Fatalf("unexpected script: %s", script)
+	}
+}
+
+// Ensure the System Events setter sets the picture of every desktop.
+func TestSystemEventsWallpaperSetter(t *testing.T) {
+	var script string
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		b, _ := ioutil.ReadAll(stdin)
+		script = string(b)
+		return nil, nil
+	}
+
+	if err := boxer.SystemEventsWallpaperSetter(exec, "/tmp/\"a\".png"); err != nil {
+		t.Fatal(err)
+	} else if script != "tell application \"System Events\"\n  tell every desktop to set picture to \"/tmp/\\\"a\\\".png\"\nend tell" {
+		t.Fatalf("unexpected script: %s", script)
+	}
+}
+
+// Ensure the wallpaper is generated empty rather than with a NaN fill when
+// there are no steps.
+func TestWallpaperHandler_ZeroSteps(t *testing.T) {
+	var pcts []float64
+	h := boxer.NewWallpaperHandler(
+		func(name string, args []string, stdin io.Reader) ([]byte, error) { return nil, nil },
+		func(exec boxer.CommandExecutor) (w, h int, err error) { return 100, 200, nil },
+		func(path string, w, h int, pct float64) error {
+			pcts = append(pcts, pct)
+			return nil
+		},
+		"",
+	)
+
+	if err := h(0, 0); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(pcts, []float64{0}) {
+		t.Fatalf("unexpected pcts: %v", pcts)
+	}
+}
+
 // Ensure that wallpaper returns an error if the desktop size cannot be determined.
 func TestWallpaperHandler_ErrSizer(t *testing.T) {
 	sizer := func(exec boxer.CommandExecutor) (w, h int, err error) {
@@ -93,6 +541,135 @@ func TestWallpaperHandler_ErrSetWallpaper(t *testing.T) {
 	}
 }
 
+// Ensure that the completed wallpaper is archived at the end of an interval.
+func TestArchiveHandler(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	sizer := func(exec boxer.CommandExecutor) (w, h int, err error) { return 100, 200, nil }
+	generator := func(path string, w, h int, pct float64) error {
+		if pct != 1.0 {
+			t.Fatalf("unexpected pct: %f", pct)
+		}
+		return ioutil.WriteFile(path, nil, 0666)
+	}
+	now := func() time.Time { return time.Date(2000, 1, 1, 9, 15, 0, 0, time.UTC) }
+
+	// Execute every step of the interval.
+	h := boxer.NewArchiveHandler(nil, sizer, generator, now, path)
+	for i := 0; i < 15; i++ {
+		if err := h(i, 15); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Verify a single file was archived.
+	if fis, err := ioutil.ReadDir(path); err != nil {
+		t.Fatal(err)
+	} else if len(fis) != 1 {
+		t.Fatalf("unexpected file count: %d", len(fis))
+	} else if fis[0].Name() != "wallpaper_20000101T091500_0000.png" {
+		t.Fatalf("unexpected file name: %s", fis[0].Name())
+	}
+}
+
+// Ensure that only the most recent wallpapers are kept when pruning.
+func TestPruneWallpapers(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	// Write wallpapers with increasing modification times and one unrelated file.
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		filename := filepath.Join(path, fmt.Sprintf("wallpaper_0100_0200_%02d_05.png", i))
+		if err := ioutil.WriteFile(filename, nil, 0666); err != nil {
+			t.Fatal(err)
+		} else if err := os.Chtimes(filename, now, now.Add(time.Duration(i)*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(path, "other.png"), nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// Prune all but the two most recent.
+	if err := boxer.PruneWallpapers(path, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	// Verify the remaining files.
+	fis, err := ioutil.ReadDir(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, fi := range fis {
+		names = append(names, fi.Name())
+	}
+	if !reflect.DeepEqual(names, []string{"other.png", "wallpaper_0100_0200_03_05.png", "wallpaper_0100_0200_04_05.png"}) {
+		t.Fatalf("unexpected files: %v", names)
+	}
+}
+
+// Ensure wallpapers for screens that are not four digits wide or tall are pruned.
+func TestPruneWallpapers_Dimensions(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	now := time.Now()
+	for i, name := range []string{
+		"wallpaper_800_600_00_05.png",
+		"wallpaper_abc123_12800_7200_01_05_dark.png",
+		"wallpaper_0100_0200_02_120.jpg",
+	} {
+		filename := filepath.Join(path, name)
+		if err := ioutil.WriteFile(filename, nil, 0666); err != nil {
+			t.Fatal(err)
+		} else if err := os.Chtimes(filename, now, now.Add(time.Duration(i)*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := boxer.PruneWallpapers(path, 1); err != nil {
+		t.Fatal(err)
+	} else if fis, err := ioutil.ReadDir(path); err != nil {
+		t.Fatal(err)
+	} else if len(fis) != 1 || fis[0].Name() != "wallpaper_0100_0200_02_120.jpg" {
+		t.Fatalf("unexpected files: %v", fis)
+	}
+}
+
+// Ensure that pruning with a negative keep count returns an error.
+func TestPruneWallpapers_ErrKeep(t *testing.T) {
+	if err := boxer.PruneWallpapers(os.TempDir(), -1); err == nil || err.Error() != "invalid keep count: -1" {
+		t.Fatal(err)
+	}
+}
+
+// Ensure the eased generator passes the eased fraction to the generator.
+func TestNewEasedWallpaperGenerator(t *testing.T) {
+	var pct float64
+	generator := boxer.NewEasedWallpaperGenerator(func(path string, w, h int, v float64) error {
+		pct = v
+		return nil
+	}, boxer.EaseIn)
+
+	if err := generator("/path", 10, 10, 0.5); err != nil {
+		t.Fatal(err)
+	} else if pct != 0.25 {
+		t.Fatalf("unexpected pct: %v", pct)
+	}
+}
+
 // Ensure that a wallpaper can be generated.
 func TestGenerateWallpaper(t *testing.T) {
 	// Generate a new wallpaper image to a temp file.
@@ -123,48 +700,452 @@ func TestGenerateWallpaper(t *testing.T) {
 	os.Remove(path)
 }
 
-// Ensure the desktop size can be calculated via AppleScript.
-func TestDesktopSize(t *testing.T) {
-	// Return the expected output.
-	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
-		return []byte("0, 0, 2560, 1440\n"), nil
+// Ensure that a status icon can be generated with the wallpaper generator.
+func TestStatusIconHandler(t *testing.T) {
+	fg := color.RGBA{R: 0xFF, G: 0x00, B: 0x00, A: 0xFF}
+	bg := color.RGBA{R: 0x00, G: 0x00, B: 0xFF, A: 0xFF}
+	generator, err := boxer.NewWallpaperGenerator(time.Now, nil, []color.RGBA{fg}, []color.RGBA{bg})
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	w, h, err := boxer.DesktopSize(exec)
-	if err != nil {
+	// Generate an icon that is a quarter of the way through the interval.
+	path := NewTempFile()
+	defer os.Remove(path)
+	if err := boxer.NewStatusIconHandler(generator, path)(1, 4); err != nil {
 		t.Fatal(err)
-	} else if w != 2560 {
-		t.Fatalf("unexpected width: %d", w)
-	} else if h != 1440 {
-		t.Fatalf("unexpected height: %d", h)
 	}
-}
 
-// Ensure the desktop size returns an error if osascript cannot be executed.
-func TestDesktopSize_ErrSystem(t *testing.T) {
-	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
-		return []byte("cannot run"), errors.New("")
+	// Decode the icon and verify the size and fill.
+	if m := MustDecodePNG(path); m.Bounds() != image.Rect(0, 0, 32, 32) {
+		t.Fatalf("unexpected bounds: %s", m.Bounds())
+	} else if c := color.RGBAModel.Convert(m.At(0, 7)); c != fg {
+		t.Fatalf("unexpected foreground: %#v", c)
+	} else if c := color.RGBAModel.Convert(m.At(0, 8)); c != bg {
+		t.Fatalf("unexpected background: %#v", c)
 	}
-	if _, _, err := boxer.DesktopSize(exec); err == nil || err.Error() != `exec: cannot run` {
-		t.Fatal(err)
+}
+
+// Ensure the foreground fills from the configured edge.
+func TestNewWallpaperGenerator_FillDirection(t *testing.T) {
+	fg := color.RGBA{R: 0xFF, G: 0x00, B: 0x00, A: 0xFF}
+	bg := color.RGBA{R: 0x00, G: 0x00, B: 0xFF, A: 0xFF}
+
+	for _, tt := range []struct {
+		dir    boxer.FillDirection
+		fg, bg int // y coordinates
+	}{
+		{dir: boxer.FillTop, fg: 24, bg: 25},
+		{dir: boxer.FillBottom, fg: 75, bg: 74},
+	} {
+		generator, err := boxer.NewWallpaperGeneratorWithOptions(time.Now, nil, []color.RGBA{fg}, []color.RGBA{bg}, boxer.WallpaperOptions{Direction: tt.dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		path := NewTempFile()
+		defer os.Remove(path)
+		if err := generator(path, 10, 100, 0.25); err != nil {
+			t.Fatal(err)
+		}
+
+		m := MustDecodePNG(path)
+		if c := color.RGBAModel.Convert(m.At(0, tt.fg)); c != fg {
+			t.Fatalf("%d: unexpected foreground: %#v", tt.dir, c)
+		} else if c := color.RGBAModel.Convert(m.At(0, tt.bg)); c != bg {
+			t.Fatalf("%d: unexpected background: %#v", tt.dir, c)
+		}
 	}
 }
 
-// Ensure the desktop size returns an error if the output is not the correct format.
-func TestDesktopSize_ErrUnexpectedOutput(t *testing.T) {
-	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
-		return []byte("oh no!"), nil
+// Ensure a divider is drawn along the edge of the foreground.
+func TestNewWallpaperGenerator_Divider(t *testing.T) {
+	fg := color.RGBA{R: 0xFF, G: 0x00, B: 0x00, A: 0xFF}
+	bg := color.RGBA{R: 0x00, G: 0x00, B: 0xFF, A: 0xFF}
+	divider := color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+
+	generator, err := boxer.NewWallpaperGeneratorWithOptions(time.Now, nil, []color.RGBA{fg}, []color.RGBA{bg}, boxer.WallpaperOptions{DividerColor: divider})
+	if err != nil {
+		t.Fatal(err)
 	}
-	if _, _, err := boxer.DesktopSize(exec); err == nil || err.Error() != `unexpected exec output: oh no!` {
+
+	path := NewTempFile()
+	defer os.Remove(path)
+	if err := generator(path, 10, 100, 0.25); err != nil {
 		t.Fatal(err)
 	}
-}
 
-// NewTempFile returns a path to a non-existent temporary file path.
-func NewTempFile() string {
-	f, _ := ioutil.TempFile("", "")
-	os.Remove(f.Name())
-	return f.Name()
+	m := MustDecodePNG(path)
+	for y, exp := range map[int]color.RGBA{24: fg, 25: divider, 26: divider, 27: bg} {
+		if c := color.RGBAModel.Convert(m.At(0, y)); c != exp {
+			t.Fatalf("%d: unexpected color: %#v", y, c)
+		}
+	}
+}
+
+// Ensure completed tomatoes are filled in and the rest are outlined.
+func TestNewTomatoCountGenerator(t *testing.T) {
+	fg := color.RGBA{R: 0xFF, G: 0x00, B: 0x00, A: 0xFF}
+	bg := color.RGBA{R: 0x00, G: 0x00, B: 0xFF, A: 0xFF}
+	generator := boxer.NewTomatoCountGenerator(func() int { return 3 }, 8, fg, bg, boxer.WallpaperOptions{})
+
+	path := NewTempFile()
+	defer os.Remove(path)
+	if err := generator(path, 80, 20, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each tomato is centered within a 10 pixel wide cell.
+	m := MustDecodePNG(path)
+	for pt, exp := range map[image.Point]color.RGBA{
+		{5, 10}:  fg, // first tomato is filled
+		{25, 10}: fg, // third tomato is filled
+		{35, 10}: bg, // fourth tomato is hollow
+		{38, 10}: fg, // fourth tomato's outline
+		{75, 10}: bg, // last tomato is hollow
+		{0, 0}:   bg,
+	} {
+		if c := color.RGBAModel.Convert(m.At(pt.X, pt.Y)); c != exp {
+			t.Fatalf("%s: unexpected color: %#v", pt, c)
+		}
+	}
+}
+
+// Ensure the cycling generator uses the foreground at the interval index.
+func TestNewCyclingWallpaperGenerator(t *testing.T) {
+	fgs := []color.RGBA{{R: 0xFF, A: 0xFF}, {G: 0xFF, A: 0xFF}, {B: 0xFF, A: 0xFF}}
+	bg := color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+
+	var index int
+	generator := boxer.NewCyclingWallpaperGenerator(func() int { return index }, fgs, bg, boxer.WallpaperOptions{})
+
+	path := NewTempFile()
+	defer os.Remove(path)
+	for index = 0; index < 4; index++ {
+		if err := generator(path, 10, 10, 0.5); err != nil {
+			t.Fatal(err)
+		}
+
+		m := MustDecodePNG(path)
+		if c := color.RGBAModel.Convert(m.At(0, 0)); c != fgs[index%3] {
+			t.Fatalf("%d: unexpected foreground: %#v", index, c)
+		} else if c := color.RGBAModel.Convert(m.At(0, 9)); c != bg {
+			t.Fatalf("%d: unexpected background: %#v", index, c)
+		}
+	}
+}
+
+// Ensure the generator encodes a JPEG when the path has a ".jpg" extension.
+func TestNewWallpaperGenerator_JPEG(t *testing.T) {
+	fg := color.RGBA{R: 0xFF, G: 0x00, B: 0x00, A: 0xFF}
+	bg := color.RGBA{R: 0x00, G: 0x00, B: 0xFF, A: 0xFF}
+	generator, err := boxer.NewWallpaperGeneratorWithOptions(time.Now, nil, []color.RGBA{fg}, []color.RGBA{bg}, boxer.WallpaperOptions{Quality: 85})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := NewTempFile() + ".jpg"
+	defer os.Remove(path)
+	if err := generator(path, 100, 100, 0.25); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if m, format, err := image.Decode(f); err != nil {
+		t.Fatal(err)
+	} else if format != "jpeg" {
+		t.Fatalf("unexpected format: %s", format)
+	} else if m.Bounds() != image.Rect(0, 0, 100, 100) {
+		t.Fatalf("unexpected bounds: %s", m.Bounds())
+	}
+}
+
+// Ensure a watermark is composited into the corner of the wallpaper.
+func TestNewWallpaperGenerator_Watermark(t *testing.T) {
+	fg := color.RGBA{R: 0xFF, G: 0x00, B: 0x00, A: 0xFF}
+	bg := color.RGBA{R: 0x00, G: 0x00, B: 0xFF, A: 0xFF}
+
+	// Write a small logo with a distinct color.
+	logo := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	draw.Draw(logo, logo.Bounds(), &image.Uniform{color.RGBA{G: 0xFF, A: 0xFF}}, image.ZP, draw.Src)
+	logoPath := NewTempFile()
+	defer os.Remove(logoPath)
+	if f, err := os.Create(logoPath); err != nil {
+		t.Fatal(err)
+	} else if err := png.Encode(f, logo); err != nil {
+		t.Fatal(err)
+	} else if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	wm, err := boxer.LoadImage(logoPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generator, err := boxer.NewWallpaperGeneratorWithOptions(time.Now, nil, []color.RGBA{fg}, []color.RGBA{bg}, boxer.WallpaperOptions{
+		Watermark:         wm,
+		WatermarkPosition: boxer.WatermarkBottomRight,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := NewTempFile()
+	defer os.Remove(path)
+	if err := generator(path, 100, 100, 0.25); err != nil {
+		t.Fatal(err)
+	}
+
+	// Verify the logo is inset from the bottom right corner.
+	m := MustDecodePNG(path)
+	for y := 76; y < 80; y++ {
+		for x := 76; x < 80; x++ {
+			if c := color.RGBAModel.Convert(m.At(x, y)); c != (color.RGBA{G: 0xFF, A: 0xFF}) {
+				t.Fatalf("unexpected watermark color at (%d,%d): %#v", x, y, c)
+			}
+		}
+	}
+	if c := color.RGBAModel.Convert(m.At(80, 80)); c != bg {
+		t.Fatalf("unexpected background: %#v", c)
+	}
+}
+
+// Ensure a missing or invalid image returns an error.
+func TestLoadImage_Err(t *testing.T) {
+	if _, err := boxer.LoadImage("/no/such/logo.png"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	path := NewTempFile()
+	defer os.Remove(path)
+	if err := ioutil.WriteFile(path, []byte("not an image"), 0666); err != nil {
+		t.Fatal(err)
+	} else if _, err := boxer.LoadImage(path); err == nil || !strings.HasPrefix(err.Error(), "decode image: ") {
+		t.Fatal(err)
+	}
+}
+
+// Ensure the gradient generator blends the background from top to bottom.
+func TestGradientWallpaperGenerator(t *testing.T) {
+	fg := color.RGBA{R: 0xFF, G: 0x00, B: 0x00, A: 0xFF}
+	from := color.RGBA{R: 0x00, G: 0x00, B: 0x00, A: 0xFF}
+	to := color.RGBA{R: 0x00, G: 0x80, B: 0xFF, A: 0xFF}
+	generator := boxer.NewGradientWallpaperGenerator(fg, from, to, boxer.WallpaperOptions{})
+
+	// Verify the endpoint colors without any foreground.
+	path := NewTempFile()
+	defer os.Remove(path)
+	if err := generator(path, 10, 100, 0); err != nil {
+		t.Fatal(err)
+	}
+	m := MustDecodePNG(path)
+	if c := color.RGBAModel.Convert(m.At(0, 0)); c != from {
+		t.Fatalf("unexpected top color: %#v", c)
+	} else if c := color.RGBAModel.Convert(m.At(9, 99)); c != to {
+		t.Fatalf("unexpected bottom color: %#v", c)
+	}
+
+	// Verify the foreground is drawn over the gradient.
+	if err := generator(path, 10, 100, 0.5); err != nil {
+		t.Fatal(err)
+	}
+	m = MustDecodePNG(path)
+	if c := color.RGBAModel.Convert(m.At(0, 49)); c != fg {
+		t.Fatalf("unexpected foreground: %#v", c)
+	} else if c := color.RGBAModel.Convert(m.At(0, 99)); c != to {
+		t.Fatalf("unexpected bottom color: %#v", c)
+	}
+}
+
+// Ensure the palette generator blends the foreground between palette colors.
+func TestPaletteLerpWallpaperGenerator(t *testing.T) {
+	palette := []color.RGBA{
+		{R: 0x00, G: 0x00, B: 0x00, A: 0xFF},
+		{R: 0x80, G: 0x40, B: 0x20, A: 0xFF},
+		{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF},
+	}
+	bg := color.RGBA{R: 0x00, G: 0x00, B: 0xFF, A: 0xFF}
+
+	path := NewTempFile()
+	defer os.Remove(path)
+	if err := boxer.NewPaletteLerpWallpaperGenerator(bg, palette, boxer.WallpaperOptions{})(path, 10, 100, 0.25); err != nil {
+		t.Fatal(err)
+	}
+
+	// Verify the foreground is halfway between the first two palette colors.
+	m := MustDecodePNG(path)
+	if c := color.RGBAModel.Convert(m.At(0, 0)); c != (color.RGBA{R: 0x40, G: 0x20, B: 0x10, A: 0xFF}) {
+		t.Fatalf("unexpected foreground: %#v", c)
+	} else if c := color.RGBAModel.Convert(m.At(0, 25)); c != bg {
+		t.Fatalf("unexpected background: %#v", c)
+	}
+}
+
+// Ensure the palette is interpolated at the edges and between colors.
+func TestLerpPalette(t *testing.T) {
+	palette := []color.RGBA{{R: 0x00, A: 0xFF}, {R: 0x80, A: 0xFF}, {R: 0xFF, A: 0xFF}}
+	for i, tt := range []struct {
+		pct    float64
+		result color.Color
+	}{
+		{pct: 0, result: color.RGBA{R: 0x00, A: 0xFF}},
+		{pct: 0.25, result: color.RGBA{R: 0x40, A: 0xFF}},
+		{pct: 0.5, result: color.RGBA{R: 0x80, A: 0xFF}},
+		{pct: 1, result: color.RGBA{R: 0xFF, A: 0xFF}},
+		{pct: 2, result: color.RGBA{R: 0xFF, A: 0xFF}},
+	} {
+		if result := boxer.LerpPalette(palette, tt.pct); !reflect.DeepEqual(tt.result, result) {
+			t.Errorf("%d. mismatch:\n\nexp=%#v\n\ngot=%#v", i, tt.result, result)
+		}
+	}
+}
+
+// Ensure the desktop size can be calculated via AppleScript.
+func TestDesktopSize(t *testing.T) {
+	// Return the expected output.
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		return []byte("0, 0, 2560, 1440\n"), nil
+	}
+
+	w, h, err := boxer.DesktopSize(exec)
+	if err != nil {
+		t.Fatal(err)
+	} else if w != 2560 {
+		t.Fatalf("unexpected width: %d", w)
+	} else if h != 1440 {
+		t.Fatalf("unexpected height: %d", h)
+	}
+}
+
+// Ensure the desktop size returns an error if osascript cannot be executed.
+func TestDesktopSize_ErrSystem(t *testing.T) {
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		return []byte("cannot run"), errors.New("")
+	}
+	if _, _, err := boxer.DesktopSize(exec); err == nil || err.Error() != `exec: cannot run` {
+		t.Fatal(err)
+	}
+}
+
+// Ensure the desktop size returns an error if the output is not the correct format.
+func TestDesktopSize_ErrUnexpectedOutput(t *testing.T) {
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		return []byte("oh no!"), nil
+	}
+	if _, _, err := boxer.DesktopSize(exec); err == nil || err.Error() != `unexpected exec output: oh no!` {
+		t.Fatal(err)
+	}
+}
+
+// Ensure the fixed desktop sizer returns its size without executing commands.
+func TestFixedDesktopSize(t *testing.T) {
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		t.Fatal("unexpected exec")
+		return nil, nil
+	}
+
+	w, h, err := boxer.FixedDesktopSize(1920, 1080)(exec)
+	if err != nil {
+		t.Fatal(err)
+	} else if w != 1920 {
+		t.Fatalf("unexpected width: %d", w)
+	} else if h != 1080 {
+		t.Fatalf("unexpected height: %d", h)
+	}
+}
+
+// Ensure the desktop size can be scaled by the backing scale factor.
+func TestAutoScaleDesktopSizer(t *testing.T) {
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		return []byte("2\n"), nil
+	}
+	sizer := func(exec boxer.CommandExecutor) (w, h int, err error) { return 1512, 982, nil }
+
+	w, h, err := boxer.AutoScaleDesktopSizer(sizer)(exec)
+	if err != nil {
+		t.Fatal(err)
+	} else if w != 3024 {
+		t.Fatalf("unexpected width: %d", w)
+	} else if h != 1964 {
+		t.Fatalf("unexpected height: %d", h)
+	}
+}
+
+// Ensure the backing scale factor returns an error if the output is not the correct format.
+func TestBackingScaleFactor_ErrUnexpectedOutput(t *testing.T) {
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		return []byte("oh no!"), nil
+	}
+	if _, err := boxer.BackingScaleFactor(exec); err == nil || err.Error() != `unexpected exec output: oh no!` {
+		t.Fatal(err)
+	}
+}
+
+// Ensure the bounds of each display can be calculated via JavaScript for Automation.
+func TestDesktopSizes(t *testing.T) {
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		return []byte("0, 0, 1512, 982\n-1920, 0, 1920, 1080\n"), nil
+	}
+
+	a, err := boxer.DesktopSizes(exec)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(a, []image.Rectangle{image.Rect(0, 0, 1512, 982), image.Rect(-1920, 0, 0, 1080)}) {
+		t.Fatalf("unexpected sizes: %v", a)
+	}
+}
+
+// Ensure the display sizes return an error if the output is not the correct format.
+func TestDesktopSizes_ErrUnexpectedOutput(t *testing.T) {
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		return []byte("oh no!"), nil
+	}
+	if _, err := boxer.DesktopSizes(exec); err == nil || err.Error() != `unexpected exec output: oh no!` {
+		t.Fatal(err)
+	}
+}
+
+// Ensure the primary desktop size only includes the first display.
+func TestPrimaryDesktopSize(t *testing.T) {
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		return []byte("0, 0, 1512, 982\n-1920, 0, 1920, 1080\n"), nil
+	}
+
+	w, h, err := boxer.PrimaryDesktopSize(exec)
+	if err != nil {
+		t.Fatal(err)
+	} else if w != 1512 {
+		t.Fatalf("unexpected width: %d", w)
+	} else if h != 982 {
+		t.Fatalf("unexpected height: %d", h)
+	}
+}
+
+// NewTempFile returns a path to a non-existent temporary file path.
+func NewTempFile() string {
+	f, _ := ioutil.TempFile("", "")
+	os.Remove(f.Name())
+	return f.Name()
+}
+
+// MustDecodePNG decodes the PNG image at path. Panic on error.
+func MustDecodePNG(path string) image.Image {
+	f, err := os.Open(path)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	m, err := png.Decode(f)
+	if err != nil {
+		panic(err)
+	}
+	return m
 }
 
 // FilesEqual returns true if two files contain the same data.
@@ -177,3 +1158,523 @@ func FilesEqual(a, b string) bool {
 		return bytes.Equal(abuf, bbuf)
 	}
 }
+
+// Ensure the screen flash handler only flashes on the final step.
+func TestScreenFlashHandler(t *testing.T) {
+	var flashed []int
+	var step int
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		if len(args) == 0 {
+			return []byte("false\n"), nil
+		}
+		flashed = append(flashed, step)
+		return nil, nil
+	}
+
+	h := boxer.NewScreenFlashHandler(exec, color.RGBA{R: 0xFF, A: 0xFF}, 1*time.Second)
+	for step = 0; step < 5; step++ {
+		if err := h(step, 5); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !reflect.DeepEqual(flashed, []int{4}) {
+		t.Fatalf("unexpected flashed steps: %v", flashed)
+	}
+}
+
+// Ensure the screen flash handler is skipped when a full screen app is active.
+func TestScreenFlashHandler_FullScreen(t *testing.T) {
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		if len(args) != 0 {
+			t.Fatal("unexpected flash")
+		}
+		return []byte("true\n"), nil
+	}
+
+	h := boxer.NewScreenFlashHandler(exec, color.RGBA{R: 0xFF, A: 0xFF}, 1*time.Second)
+	if err := h(4, 5); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure the night shift handler sets the strength based on the step.
+func TestNightShiftHandler(t *testing.T) {
+	var strengths []string
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		b, _ := ioutil.ReadAll(stdin)
+		if m := regexp.MustCompile(`setStrengthCommit\(([0-9.]+), true\)`).FindStringSubmatch(string(b)); m == nil {
+			t.Fatalf("unexpected script:\n\n%s", b)
+		} else {
+			strengths = append(strengths, m[1])
+		}
+		return nil, nil
+	}
+	now := func() time.Time { return time.Date(2000, 1, 1, 20, 0, 0, 0, time.UTC) }
+
+	h := boxer.NewNightShiftHandler(exec, now, &boxer.Schedule{Start: 19 * time.Hour, End: 7 * time.Hour})
+	for _, i := range []int{0, 2, 3} {
+		if err := h(i, 4); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !reflect.DeepEqual(strengths, []string{"0.000000", "0.500000", "0.750000"}) {
+		t.Fatalf("unexpected strengths: %v", strengths)
+	}
+}
+
+// Ensure the night shift handler does nothing before the scheduled time.
+func TestNightShiftHandler_BeforeSchedule(t *testing.T) {
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		t.Fatal("unexpected exec")
+		return nil, nil
+	}
+	now := func() time.Time { return time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC) }
+
+	h := boxer.NewNightShiftHandler(exec, now, &boxer.Schedule{Start: 19 * time.Hour, End: 7 * time.Hour})
+	if err := h(2, 4); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure the night shift handler keeps running after midnight until the end
+// of the schedule on the following morning.
+func TestNightShiftHandler_AfterMidnight(t *testing.T) {
+	var n int
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		n++
+		return nil, nil
+	}
+	now := time.Date(2000, 1, 1, 23, 30, 0, 0, time.UTC)
+
+	h := boxer.NewNightShiftHandler(exec, func() time.Time { return now }, &boxer.Schedule{Start: 19 * time.Hour, End: 7 * time.Hour})
+	for _, v := range []time.Time{
+		time.Date(2000, 1, 1, 23, 30, 0, 0, time.UTC),
+		time.Date(2000, 1, 2, 0, 30, 0, 0, time.UTC),
+		time.Date(2000, 1, 2, 6, 59, 0, 0, time.UTC),
+		time.Date(2000, 1, 2, 7, 0, 0, 0, time.UTC),
+	} {
+		now = v
+		if err := h(2, 4); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The step at 7:00am is outside the schedule.
+	if n != 3 {
+		t.Fatalf("unexpected exec count: %d", n)
+	}
+}
+
+// Ensure desktop icons are hidden on the first step and shown on the last.
+func TestDesktopIconsHandler(t *testing.T) {
+	var calls []string
+	h := &boxer.DesktopIconsHandler{
+		Exec: func(name string, args []string, stdin io.Reader) ([]byte, error) {
+			calls = append(calls, strings.Join(append([]string{name}, args...), " "))
+			if len(args) > 0 && args[0] == "read" {
+				return []byte("1\n"), nil
+			}
+			return nil, nil
+		},
+	}
+
+	if err := h.Capture(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := h.Handle(i, 3); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := h.Restore(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(calls, []string{
+		boxer.DefaultsPath + " read com.apple.finder CreateDesktop",
+		boxer.DefaultsPath + " write com.apple.finder CreateDesktop -bool false",
+		boxer.KillallPath + " Finder",
+		boxer.DefaultsPath + " write com.apple.finder CreateDesktop -bool true",
+		boxer.KillallPath + " Finder",
+	}) {
+		t.Fatalf("unexpected calls: %q", calls)
+	}
+}
+
+// Ensure hidden desktop icons are shown when restored mid-interval.
+func TestDesktopIconsHandler_Restore(t *testing.T) {
+	var calls []string
+	h := &boxer.DesktopIconsHandler{
+		Exec: func(name string, args []string, stdin io.Reader) ([]byte, error) {
+			calls = append(calls, strings.Join(append([]string{name}, args...), " "))
+			return nil, nil
+		},
+	}
+
+	if err := h.Handle(0, 3); err != nil {
+		t.Fatal(err)
+	} else if err := h.Restore(); err != nil {
+		t.Fatal(err)
+	} else if len(calls) != 4 || calls[2] != boxer.DefaultsPath+" write com.apple.finder CreateDesktop -bool true" {
+		t.Fatalf("unexpected calls: %q", calls)
+	}
+}
+
+// Ensure desktop icons are left alone if the user already hides them.
+func TestDesktopIconsHandler_AlreadyHidden(t *testing.T) {
+	var n int
+	h := &boxer.DesktopIconsHandler{
+		Exec: func(name string, args []string, stdin io.Reader) ([]byte, error) {
+			n++
+			return []byte("0\n"), nil
+		},
+	}
+
+	if err := h.Capture(); err != nil {
+		t.Fatal(err)
+	} else if err := h.Handle(0, 3); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("unexpected exec count: %d", n)
+	}
+}
+
+// Ensure the menu bar is hidden at the start of an interval and shown at the end.
+func TestMenuBarAutohideHandler(t *testing.T) {
+	var calls []string
+	h := &boxer.MenuBarAutohideHandler{
+		Exec: func(name string, args []string, stdin io.Reader) ([]byte, error) {
+			calls = append(calls, strings.Join(append([]string{name}, args...), " "))
+			if len(args) > 0 && args[0] == "read" {
+				return []byte("0\n"), nil
+			}
+			return nil, nil
+		},
+	}
+
+	if err := h.Capture(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := h.Handle(i, 3); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := h.Restore(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(calls, []string{
+		boxer.DefaultsPath + " read NSGlobalDomain _HIHideMenuBar",
+		boxer.DefaultsPath + " write NSGlobalDomain _HIHideMenuBar -bool true",
+		boxer.KillallPath + " SystemUIServer",
+		boxer.DefaultsPath + " write NSGlobalDomain _HIHideMenuBar -bool false",
+		boxer.KillallPath + " SystemUIServer",
+	}) {
+		t.Fatalf("unexpected calls: %q", calls)
+	}
+}
+
+// Ensure a hidden menu bar is shown when restored mid-interval.
+func TestMenuBarAutohideHandler_Restore(t *testing.T) {
+	var calls []string
+	h := &boxer.MenuBarAutohideHandler{
+		Exec: func(name string, args []string, stdin io.Reader) ([]byte, error) {
+			calls = append(calls, strings.Join(append([]string{name}, args...), " "))
+			return nil, nil
+		},
+	}
+
+	if err := h.Handle(0, 3); err != nil {
+		t.Fatal(err)
+	} else if err := h.Restore(); err != nil {
+		t.Fatal(err)
+	} else if len(calls) != 4 || calls[2] != boxer.DefaultsPath+" write NSGlobalDomain _HIHideMenuBar -bool false" {
+		t.Fatalf("unexpected calls: %q", calls)
+	}
+}
+
+// Ensure the menu bar is left alone if the user already auto-hides it.
+func TestMenuBarAutohideHandler_AlreadyHidden(t *testing.T) {
+	var n int
+	h := &boxer.MenuBarAutohideHandler{
+		Exec: func(name string, args []string, stdin io.Reader) ([]byte, error) {
+			n++
+			return []byte("1\n"), nil
+		},
+	}
+
+	if err := h.Capture(); err != nil {
+		t.Fatal(err)
+	} else if err := h.Handle(0, 3); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("unexpected exec count: %d", n)
+	}
+}
+
+// Ensure the accent color handler picks colors by progress and clamps the index.
+func TestAccentColorHandler(t *testing.T) {
+	var values []string
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		if name == boxer.DefaultsPath {
+			values = append(values, args[len(args)-1])
+		} else if b, _ := ioutil.ReadAll(stdin); !strings.Contains(string(b), "set highlight color to {") {
+			t.Fatalf("unexpected script:\n\n%s", b)
+		}
+		return nil, nil
+	}
+
+	h := boxer.NewAccentColorHandler(exec, []color.RGBA{{R: 0xFF}, {G: 0xFF}})
+	for _, i := range []int{0, 1, 2, 3, 4} {
+		if err := h(i, 4); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !reflect.DeepEqual(values, []string{
+		"1.000000 0.000000 0.000000 Other",
+		"1.000000 0.000000 0.000000 Other",
+		"0.000000 1.000000 0.000000 Other",
+		"0.000000 1.000000 0.000000 Other",
+		"0.000000 1.000000 0.000000 Other",
+	}) {
+		t.Fatalf("unexpected values: %v", values)
+	}
+}
+
+// Ensure the touch bar handler draws progress when a Touch Bar is present.
+func TestTouchBarHandler(t *testing.T) {
+	var detections int
+	var args []string
+	exec := func(name string, a []string, stdin io.Reader) ([]byte, error) {
+		switch name {
+		case boxer.IORegPath:
+			detections++
+			return []byte("+-o AppleEmbeddedOSSupportHost\n"), nil
+		case boxer.TouchBarHelperPath:
+			args = append(args, a...)
+			return nil, nil
+		}
+		t.Fatalf("unexpected exec: %s", name)
+		return nil, nil
+	}
+
+	h := boxer.NewTouchBarHandler(exec)
+	for i := 0; i < 2; i++ {
+		if err := h(i, 4); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if detections != 1 {
+		t.Fatalf("unexpected detections: %d", detections)
+	} else if !reflect.DeepEqual(args, []string{"0.0000", "0.2500"}) {
+		t.Fatalf("unexpected args: %v", args)
+	}
+}
+
+// Ensure the touch bar handler does nothing when no Touch Bar is present.
+func TestTouchBarHandler_NotPresent(t *testing.T) {
+	var detections int
+	exec := func(name string, a []string, stdin io.Reader) ([]byte, error) {
+		if name != boxer.IORegPath {
+			t.Fatalf("unexpected exec: %s", name)
+		}
+		detections++
+		return nil, nil
+	}
+
+	h := boxer.NewTouchBarHandler(exec)
+	for i := 0; i < 3; i++ {
+		if err := h(i, 4); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if detections != 1 {
+		t.Fatalf("unexpected detections: %d", detections)
+	}
+}
+
+// Ensure the idle gate skips the inner handler while the system is idle.
+func TestIdleGate(t *testing.T) {
+	var idle string
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		if name != boxer.IORegPath {
+			t.Fatalf("unexpected exec: %s", name)
+		}
+		return []byte(`    | |   "HIDIdleTime" = ` + idle + "\n"), nil
+	}
+
+	var calls int
+	h := boxer.NewIdleGate(exec, 5*time.Minute, func(i, n int) error {
+		calls++
+		return nil
+	})
+
+	// Skip while idle for an hour.
+	idle = "3600000000000"
+	if err := h(0, 4); err != nil {
+		t.Fatal(err)
+	} else if calls != 0 {
+		t.Fatalf("unexpected calls: %d", calls)
+	}
+
+	// Execute after recent input.
+	idle = "2000000000"
+	if err := h(1, 4); err != nil {
+		t.Fatal(err)
+	} else if calls != 1 {
+		t.Fatalf("unexpected calls: %d", calls)
+	}
+}
+
+// Ensure handlers gated by an idle checker share one query until reset.
+func TestIdleChecker(t *testing.T) {
+	var queries int
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		queries++
+		return []byte(`"HIDIdleTime" = 2000000000`), nil
+	}
+
+	var calls int
+	c := boxer.NewIdleChecker(exec, 5*time.Minute)
+	a := c.Gate(func(i, n int) error { calls++; return nil })
+	b := c.Gate(func(i, n int) error { calls++; return nil })
+
+	if err := a(0, 4); err != nil {
+		t.Fatal(err)
+	} else if err := b(0, 4); err != nil {
+		t.Fatal(err)
+	} else if calls != 2 || queries != 1 {
+		t.Fatalf("unexpected counts: calls=%d queries=%d", calls, queries)
+	}
+
+	// Query again after a reset.
+	c.Reset()
+	if err := a(1, 4); err != nil {
+		t.Fatal(err)
+	} else if calls != 3 || queries != 2 {
+		t.Fatalf("unexpected counts: calls=%d queries=%d", calls, queries)
+	}
+}
+
+// Ensure the idle gate returns an error if the idle time cannot be read.
+func TestIdleGate_ErrQuery(t *testing.T) {
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		return []byte("ioreg: not found"), errors.New("exit status 1")
+	}
+	h := boxer.NewIdleGate(exec, 5*time.Minute, func(i, n int) error {
+		t.Fatal("unexpected inner call")
+		return nil
+	})
+
+	if err := h(0, 4); err == nil || err.Error() != "idle time: exec: ioreg: not found" {
+		t.Fatal(err)
+	}
+}
+
+// Ensure the announcement includes the subtitle & sound name.
+func TestAnnouncementHandler_Options(t *testing.T) {
+	var script string
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		b, _ := ioutil.ReadAll(stdin)
+		script = string(b)
+		return nil, nil
+	}
+
+	h := boxer.NewAnnouncementHandlerWithOptions(exec, boxer.AnnouncementOptions{
+		Subtitle: `Time to "stand up"`,
+		Sound:    "Glass",
+	})
+	if err := h(0, 1); err != nil {
+		t.Fatal(err)
+	} else if !strings.HasPrefix(script, `display notification "`) {
+		t.Fatalf("unexpected script: %s", script)
+	} else if !strings.HasSuffix(script, `with title "Boxer" subtitle "Time to \"stand up\"" sound name "Glass"`) {
+		t.Fatalf("unexpected script: %s", script)
+	}
+}
+
+// Ensure the announcement formats the time with a custom layout.
+func TestAnnouncementHandler_TimeFormat(t *testing.T) {
+	var script string
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		b, _ := ioutil.ReadAll(stdin)
+		script = string(b)
+		return nil, nil
+	}
+
+	h := boxer.NewAnnouncementHandlerWithOptions(exec, boxer.AnnouncementOptions{TimeFormat: "It's 2006"})
+	if err := h(0, 1); err != nil {
+		t.Fatal(err)
+	} else if exp := fmt.Sprintf(`display notification "It's %d" with title "Boxer"`, time.Now().Year()); script != exp {
+		t.Fatalf("unexpected script: %s", script)
+	}
+}
+
+// Ensure special characters in announcement options are escaped in the script.
+func TestAnnouncementHandler_Escape(t *testing.T) {
+	var script string
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		b, _ := ioutil.ReadAll(stdin)
+		script = string(b)
+		return nil, nil
+	}
+
+	h := boxer.NewAnnouncementHandlerWithOptions(exec, boxer.AnnouncementOptions{
+		Subtitle: "C:\\break\nnow",
+		Sound:    `"; do shell script "rm`,
+	})
+	if err := h(0, 1); err != nil {
+		t.Fatal(err)
+	} else if !strings.HasSuffix(script, `subtitle "C:\\break\nnow" sound name "\"; do shell script \"rm"`) {
+		t.Fatalf("unexpected script: %s", script)
+	}
+}
+
+// Ensure the countdown handler only announces at the configured thresholds.
+func TestCountdownHandler(t *testing.T) {
+	var scripts []string
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		b, _ := ioutil.ReadAll(stdin)
+		scripts = append(scripts, string(b))
+		return nil, nil
+	}
+
+	h := boxer.NewCountdownHandler(exec, 1*time.Minute, []time.Duration{5 * time.Minute, 1 * time.Minute})
+	for i := 0; i < 15; i++ {
+		if err := h(i, 15); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !reflect.DeepEqual(scripts, []string{
+		`display notification "5 minutes remaining" with title "Boxer"`,
+		`display notification "1 minute remaining" with title "Boxer"`,
+	}) {
+		t.Fatalf("unexpected scripts: %q", scripts)
+	}
+}
+
+// Ensure the speech handler speaks at the start of each interval only.
+func TestSpeechHandler(t *testing.T) {
+	var calls [][]string
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		calls = append(calls, append([]string{name}, args...))
+		return nil, nil
+	}
+
+	h := boxer.NewSpeechHandler(exec, "Break time", "Samantha")
+	for i := 0; i < 3; i++ {
+		if err := h(i, 3); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !reflect.DeepEqual(calls, [][]string{{boxer.SayPath, "-v", "Samantha", "Break time"}}) {
+		t.Fatalf("unexpected calls: %q", calls)
+	}
+}
@@ -0,0 +1,19 @@
+package boxer
+
+import (
+	"fmt"
+	"time"
+)
+
+// NotifySendPath is the path to the "notify-send" binary.
+const NotifySendPath = `notify-send`
+
+// NewAnnouncementHandler returns a handler for announcing the current time.
+func NewAnnouncementHandler(exec CommandExecutor) Handler {
+	return func(i, n int) error {
+		if b, err := exec(NotifySendPath, []string{"Boxer", time.Now().Format("3:04pm")}, nil); err != nil {
+			return fmt.Errorf("exec notify-send: %s", b)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,39 @@
+package boxer_test
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/benbjohnson/boxer"
+)
+
+// Ensure the announcement handler displays a notification with notify-send.
+func TestAnnouncementHandler(t *testing.T) {
+	var executed bool
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		if name != "notify-send" {
+			t.Fatalf("unexpected name: %s", name)
+		} else if len(args) != 2 || args[0] != "Boxer" || args[1] == "" {
+			t.Fatalf("unexpected args: %v", args)
+		}
+		executed = true
+		return nil, nil
+	}
+
+	if err := boxer.NewAnnouncementHandler(exec)(0, 1); err != nil {
+		t.Fatal(err)
+	} else if !executed {
+		t.Fatal("notify-send not executed")
+	}
+}
+
+// Ensure the announcement handler returns an error if notify-send fails.
+func TestAnnouncementHandler_ErrExec(t *testing.T) {
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		return []byte("no display"), errors.New("exit status 1")
+	}
+	if err := boxer.NewAnnouncementHandler(exec)(0, 1); err == nil || err.Error() != `exec notify-send: no display` {
+		t.Fatal(err)
+	}
+}
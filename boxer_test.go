@@ -1,7 +1,17 @@
 package boxer_test
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
 	"image/color"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
 	"reflect"
 	"runtime"
 	"strings"
@@ -53,6 +63,1217 @@ func TestTicker_Tick(t *testing.T) {
 	}
 }
 
+// Ensure the ticker logs and returns handler errors.
+func TestTicker_Tick_Errors(t *testing.T) {
+	var buf bytes.Buffer
+	ticker := boxer.NewTicker()
+	ticker.Logger = log.New(&buf, "", 0)
+	ticker.Commands = []boxer.Command{
+		{Name: "ok", Interval: 1 * time.Minute, Handler: func(i, n int) error { return nil }},
+		{Name: "wallpaper", Interval: 1 * time.Minute, Handler: func(i, n int) error { return errors.New("write failed") }},
+	}
+
+	if errs := ticker.Tick(); len(errs) != 1 || errs[0].Error() != "wallpaper: write failed" {
+		t.Fatalf("unexpected errors: %v", errs)
+	} else if buf.String() != "wallpaper: write failed\n" {
+		t.Fatalf("unexpected log: %s", buf.String())
+	}
+}
+
+// Ensure the ticker logs the duration of each handler execution when verbose.
+func TestTicker_Tick_Verbose(t *testing.T) {
+	var buf bytes.Buffer
+	ticker := boxer.NewTicker()
+	ticker.Logger = log.New(&buf, "", 0)
+	ticker.Verbose = true
+	ticker.Commands = []boxer.Command{
+		{Name: "wallpaper", Interval: 1 * time.Minute, Handler: func(i, n int) error {
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		}},
+	}
+
+	if errs := ticker.Tick(); errs != nil {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	line := strings.TrimSpace(buf.String())
+	if !strings.HasPrefix(line, "command=wallpaper dur=") {
+		t.Fatalf("unexpected log: %s", line)
+	} else if d, err := time.ParseDuration(strings.TrimPrefix(line, "command=wallpaper dur=")); err != nil {
+		t.Fatal(err)
+	} else if d < 20*time.Millisecond {
+		t.Fatalf("unexpected duration: %s", d)
+	}
+}
+
+// Ensure the ticker can execute handlers concurrently.
+func TestTicker_Tick_Concurrent(t *testing.T) {
+	ticker := boxer.NewTicker()
+	ticker.Concurrent = true
+
+	// Each handler waits for the other to start so they can only both
+	// succeed if they are running at the same time.
+	a, b := make(chan struct{}), make(chan struct{})
+	wait := func(started, other chan struct{}) boxer.Handler {
+		return func(i, n int) error {
+			close(started)
+			select {
+			case <-other:
+				return nil
+			case <-time.After(5 * time.Second):
+				return errors.New("timeout")
+			}
+		}
+	}
+	ticker.Commands = []boxer.Command{
+		{Name: "a", Interval: 1 * time.Minute, Handler: wait(a, b)},
+		{Name: "b", Interval: 1 * time.Minute, Handler: wait(b, a)},
+	}
+
+	if errs := ticker.Tick(); errs != nil {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+}
+
+// Ensure the ticker reports the result of each handler execution.
+func TestTicker_Tick_OnResult(t *testing.T) {
+	var buf bytes.Buffer
+	ticker := boxer.NewTicker()
+	ticker.Logger = log.New(&buf, "", 0)
+	ticker.Now = func() time.Time { return time.Date(2000, time.January, 1, 0, 2, 0, 0, time.UTC) }
+	ticker.Commands = []boxer.Command{
+		{Name: "ok", Step: 1 * time.Minute, Interval: 4 * time.Minute, Handler: func(i, n int) error { return nil }},
+		{Name: "fail", Interval: 4 * time.Minute, Handler: func(i, n int) error { return errors.New("marker") }},
+	}
+
+	var results []string
+	ticker.OnResult = func(name string, i, n int, err error) {
+		results = append(results, fmt.Sprintf("%s %d/%d %v", name, i, n, err))
+	}
+	ticker.Tick()
+
+	if !reflect.DeepEqual(results, []string{"ok 2/4 <nil>", "fail 0/1 marker"}) {
+		t.Fatalf("unexpected results: %v", results)
+	} else if buf.Len() != 0 {
+		t.Fatalf("unexpected log: %s", buf.String())
+	}
+}
+
+// Ensure the ticker captures state before the first handler execution and restores it.
+func TestTicker_Restore(t *testing.T) {
+	var calls []string
+	r := &Restorable{
+		CaptureFn: func() error { calls = append(calls, "capture"); return nil },
+		RestoreFn: func() error { calls = append(calls, "restore"); return nil },
+	}
+
+	now := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	ticker := boxer.NewTicker()
+	ticker.Now = func() time.Time { return now }
+	ticker.Commands = append(ticker.Commands, boxer.Command{
+		Step:       1 * time.Minute,
+		Interval:   15 * time.Minute,
+		Handler:    func(i, n int) error { calls = append(calls, "handler"); return nil },
+		Restorable: r,
+	})
+
+	// Execute two steps and then restore.
+	ticker.Tick()
+	now = now.Add(1 * time.Minute)
+	ticker.Tick()
+	if err := ticker.Restore(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(calls, []string{"capture", "handler", "handler", "restore"}) {
+		t.Fatalf("unexpected calls: %v", calls)
+	}
+}
+
+// Ensure closing the ticker closes every command once and aggregates errors.
+func TestTicker_Close(t *testing.T) {
+	var closed []string
+	ticker := boxer.NewTicker()
+	ticker.Commands = []boxer.Command{
+		{Name: "a", Closer: &Closer{CloseFn: func() error { closed = append(closed, "a"); return errors.New("marker a") }}},
+		{Name: "b"},
+		{Name: "c", Closer: &Closer{CloseFn: func() error { closed = append(closed, "c"); return errors.New("marker c") }}},
+	}
+
+	if err := ticker.Close(); err == nil || err.Error() != "a: marker a; c: marker c" {
+		t.Fatal(err)
+	} else if err := ticker.Close(); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(closed, []string{"a", "c"}) {
+		t.Fatalf("unexpected closes: %v", closed)
+	}
+}
+
+// Ensure the ticker can tick at an explicit time without using Now.
+func TestTicker_TickAt(t *testing.T) {
+	var steps [][2]int
+	ticker := boxer.NewTicker()
+	ticker.Now = func() time.Time { t.Fatal("unexpected call to Now"); return time.Time{} }
+	ticker.Commands = append(ticker.Commands, boxer.Command{
+		Step:     1 * time.Minute,
+		Interval: 15 * time.Minute,
+		Handler: func(i, n int) error {
+			steps = append(steps, [2]int{i, n})
+			return nil
+		},
+	})
+
+	ticker.TickAt(time.Date(2000, time.January, 1, 0, 2, 0, 0, time.UTC))
+	ticker.TickAt(time.Date(2000, time.January, 1, 0, 2, 30, 0, time.UTC))
+	ticker.TickAt(time.Date(2000, time.January, 1, 0, 3, 0, 0, time.UTC))
+
+	if !reflect.DeepEqual(steps, [][2]int{{2, 15}, {3, 15}}) {
+		t.Fatalf("unexpected steps: %v", steps)
+	}
+}
+
+// Ensure the ticker can be driven by times received on a channel.
+func TestTicker_TickFrom(t *testing.T) {
+	ticker := boxer.NewTicker()
+	ticker.Now = func() time.Time { panic("unexpected call to now") }
+
+	// Record the step index & count of every handler call.
+	var steps [][2]int
+	ticker.Commands = append(ticker.Commands, boxer.Command{
+		Step:     1 * time.Minute,
+		Interval: 15 * time.Minute,
+		Handler: func(i, n int) error {
+			steps = append(steps, [2]int{i, n})
+			return nil
+		},
+	})
+
+	// Send a time for each of the first three minutes past the interval.
+	start := time.Date(2000, time.January, 1, 0, 15, 0, 0, time.UTC)
+	ch := make(chan time.Time, 3)
+	for i := 0; i < 3; i++ {
+		ch <- start.Add(time.Duration(i) * time.Minute)
+	}
+	close(ch)
+	ticker.TickFrom(ch)
+
+	// Verify a tick occurred for each time.
+	if !reflect.DeepEqual(steps, [][2]int{{0, 15}, {1, 15}, {2, 15}}) {
+		t.Fatalf("unexpected steps: %v", steps)
+	}
+}
+
+// Ensure the ticker aligns steps and intervals to the anchor time.
+func TestTicker_Tick_Anchor(t *testing.T) {
+	ticker := boxer.NewTicker()
+	ticker.Anchor = time.Date(2000, time.January, 1, 9, 0, 0, 0, time.UTC)
+
+	var steps [][2]int
+	ticker.Commands = append(ticker.Commands, boxer.Command{
+		Step:     5 * time.Minute,
+		Interval: 25 * time.Minute,
+		Handler: func(i, n int) error {
+			steps = append(steps, [2]int{i, n})
+			return nil
+		},
+	})
+
+	// The interval starting at 9:25 should be on its third step at 9:35.
+	ticker.Now = func() time.Time { return time.Date(2000, time.January, 1, 9, 35, 0, 0, time.UTC) }
+	ticker.Tick()
+
+	// The next interval should start at 9:50.
+	ticker.Now = func() time.Time { return time.Date(2000, time.January, 1, 9, 50, 0, 0, time.UTC) }
+	ticker.Tick()
+
+	if !reflect.DeepEqual(steps, [][2]int{{2, 5}, {0, 5}}) {
+		t.Fatalf("unexpected steps: %v", steps)
+	}
+}
+
+// Ensure commands can be added and looked up by name.
+func TestTicker_AddCommand(t *testing.T) {
+	ticker := boxer.NewTicker()
+	if err := ticker.AddCommand(boxer.Command{Name: "foo", Interval: 1 * time.Minute}); err != nil {
+		t.Fatal(err)
+	} else if err := ticker.AddCommand(boxer.Command{Name: "bar", Interval: 2 * time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+
+	if cmd, ok := ticker.Command("bar"); !ok {
+		t.Fatal("expected command")
+	} else if cmd.Interval != 2*time.Minute {
+		t.Fatalf("unexpected interval: %s", cmd.Interval)
+	} else if _, ok := ticker.Command("baz"); ok {
+		t.Fatal("unexpected command")
+	}
+}
+
+// Ensure adding a command with a duplicate name returns an error.
+func TestTicker_AddCommand_ErrDuplicate(t *testing.T) {
+	ticker := boxer.NewTicker()
+	if err := ticker.AddCommand(boxer.Command{Name: "foo"}); err != nil {
+		t.Fatal(err)
+	} else if err := ticker.AddCommand(boxer.Command{Name: "foo"}); err == nil || err.Error() != `duplicate command name: "foo"` {
+		t.Fatal(err)
+	} else if len(ticker.Commands) != 1 {
+		t.Fatalf("unexpected command count: %d", len(ticker.Commands))
+	}
+}
+
+// Ensure the ticker reports interval boundaries without invoking handlers.
+func TestTicker_AtIntervalBoundary(t *testing.T) {
+	ticker := boxer.NewTicker()
+	ticker.Commands = append(ticker.Commands, boxer.Command{
+		Step:     1 * time.Minute,
+		Interval: 15 * time.Minute,
+		Handler: func(i, n int) error {
+			t.Fatal("unexpected handler call")
+			return nil
+		},
+	})
+
+	for _, tt := range []struct {
+		now time.Time
+		exp bool
+	}{
+		{now: time.Date(2000, time.January, 1, 9, 0, 0, 0, time.UTC), exp: true},
+		{now: time.Date(2000, time.January, 1, 9, 0, 0, 999, time.UTC), exp: true},
+		{now: time.Date(2000, time.January, 1, 9, 0, 1, 0, time.UTC), exp: false},
+		{now: time.Date(2000, time.January, 1, 9, 0, 30, 0, time.UTC), exp: false},
+		{now: time.Date(2000, time.January, 1, 9, 1, 0, 0, time.UTC), exp: false},
+		{now: time.Date(2000, time.January, 1, 9, 7, 0, 0, time.UTC), exp: false},
+		{now: time.Date(2000, time.January, 1, 9, 15, 0, 0, time.UTC), exp: true},
+	} {
+		if v := ticker.AtIntervalBoundary(tt.now); v != tt.exp {
+			t.Fatalf("%s: unexpected result: %v", tt.now.Format("15:04:05"), v)
+		}
+	}
+}
+
+// Ensure commands without a step never report an interval boundary.
+func TestTicker_AtIntervalBoundary_ZeroStep(t *testing.T) {
+	ticker := boxer.NewTicker()
+	ticker.Commands = append(ticker.Commands, boxer.Command{
+		Interval: 15 * time.Minute,
+		Handler:  func(i, n int) error { return nil },
+	})
+
+	for _, now := range []time.Time{
+		time.Date(2000, time.January, 1, 9, 0, 0, 0, time.UTC),
+		time.Date(2000, time.January, 1, 9, 7, 0, 0, time.UTC),
+	} {
+		if ticker.AtIntervalBoundary(now) {
+			t.Fatalf("%s: expected no boundary", now.Format("15:04:05"))
+		}
+	}
+}
+
+// Ensure the last error returned by each command's handler is recorded.
+func TestTicker_LastError(t *testing.T) {
+	var fail bool
+	now := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	ticker := boxer.NewTicker()
+	ticker.Logger = log.New(ioutil.Discard, "", 0)
+	ticker.Now = func() time.Time { return now }
+	ticker.Commands = []boxer.Command{
+		{
+			Name:     "a",
+			Step:     1 * time.Minute,
+			Interval: 15 * time.Minute,
+			Handler: func(i, n int) error {
+				if fail {
+					return errors.New("marker")
+				}
+				return nil
+			},
+		},
+		{
+			Name:     "b",
+			Step:     1 * time.Minute,
+			Interval: 15 * time.Minute,
+			Handler:  func(i, n int) error { return nil },
+		},
+	}
+
+	// Verify the error is recorded for the failing command only.
+	fail = true
+	ticker.Tick()
+	if err := ticker.LastError("a"); err == nil || err.Error() != "marker" {
+		t.Fatal(err)
+	} else if err := ticker.LastError("b"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Verify the error is cleared once the handler succeeds.
+	fail, now = false, now.Add(1*time.Minute)
+	ticker.Tick()
+	if err := ticker.LastError("a"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure completed intervals are counted per day.
+func TestTicker_CompletedIntervals(t *testing.T) {
+	now := time.Date(2000, time.January, 1, 23, 0, 0, 0, time.UTC)
+	ticker := boxer.NewTicker()
+	ticker.Now = func() time.Time { return now }
+	ticker.Commands = []boxer.Command{{
+		Name:     "a",
+		Step:     1 * time.Minute,
+		Interval: 2 * time.Minute,
+		Handler:  func(i, n int) error { return nil },
+	}}
+
+	// Tick through two and a half intervals.
+	for j := 0; j < 5; j++ {
+		if errs := ticker.Tick(); len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		now = now.Add(1 * time.Minute)
+	}
+	if n := ticker.CompletedIntervals("a"); n != 2 {
+		t.Fatalf("unexpected count: %d", n)
+	} else if n := ticker.CompletedIntervals("b"); n != 0 {
+		t.Fatalf("unexpected count for unknown command: %d", n)
+	}
+
+	// Verify the count resets on the next day.
+	now = time.Date(2000, time.January, 2, 9, 0, 0, 0, time.UTC)
+	if n := ticker.CompletedIntervals("a"); n != 0 {
+		t.Fatalf("unexpected count after midnight: %d", n)
+	}
+}
+
+// Ensure the interval index advances each time a new interval begins.
+func TestTicker_IntervalIndex(t *testing.T) {
+	now := time.Date(2000, time.January, 1, 0, 1, 0, 0, time.UTC)
+	ticker := boxer.NewTicker()
+	ticker.Now = func() time.Time { return now }
+	ticker.Commands = []boxer.Command{{
+		Name:     "a",
+		Step:     1 * time.Minute,
+		Interval: 2 * time.Minute,
+		Handler:  func(i, n int) error { return nil },
+	}}
+
+	// Tick through the end of the first interval and into two more.
+	var indexes []int
+	for j := 0; j < 4; j++ {
+		ticker.Tick()
+		indexes = append(indexes, ticker.IntervalIndex("a"))
+		now = now.Add(1 * time.Minute)
+	}
+	if !reflect.DeepEqual(indexes, []int{0, 1, 1, 2}) {
+		t.Fatalf("unexpected indexes: %v", indexes)
+	} else if n := ticker.IntervalIndex("b"); n != 0 {
+		t.Fatalf("unexpected index for unknown command: %d", n)
+	}
+}
+
+// Ensure the previous day's completed intervals are summarized after midnight.
+func TestTicker_DailySummary(t *testing.T) {
+	var buf bytes.Buffer
+	now := time.Date(2000, time.January, 1, 23, 55, 0, 0, time.UTC)
+	ticker := boxer.NewTicker()
+	ticker.Logger = log.New(&buf, "", 0)
+	ticker.Now = func() time.Time { return now }
+	ticker.Commands = []boxer.Command{
+		{Name: "a", Step: 1 * time.Minute, Interval: 2 * time.Minute, Handler: func(i, n int) error { return nil }},
+		{Name: "b", Interval: 5 * time.Minute, Handler: func(i, n int) error { return nil }},
+	}
+
+	// Tick through the last five minutes of the day.
+	for j := 0; j < 5; j++ {
+		ticker.Tick()
+		now = now.Add(1 * time.Minute)
+	}
+	if s := ticker.DailySummary(); !s.Day.IsZero() {
+		t.Fatalf("unexpected summary before midnight: %s", s)
+	}
+
+	// Verify the summary reports the previous day after midnight.
+	ticker.Tick()
+	if s := ticker.DailySummary(); s.String() != "2000-01-01 a=3 b=1" {
+		t.Fatalf("unexpected summary: %s", s)
+	} else if buf.String() != "summary: 2000-01-01 a=3 b=1\n" {
+		t.Fatalf("unexpected log: %s", buf.String())
+	} else if n := ticker.CompletedIntervals("a"); n != 0 {
+		t.Fatalf("unexpected count after midnight: %d", n)
+	}
+}
+
+// Ensure the next boundary is the nearest across all commands.
+func TestTicker_NextBoundary(t *testing.T) {
+	ticker := boxer.NewTicker()
+	ticker.Commands = []boxer.Command{
+		{Name: "a", Step: 1 * time.Minute, Interval: 30 * time.Minute},
+		{Name: "b", Step: 1 * time.Minute, Interval: 15 * time.Minute},
+	}
+
+	if v, err := ticker.NextBoundary(time.Date(2000, time.January, 1, 9, 9, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	} else if exp := time.Date(2000, time.January, 1, 9, 15, 0, 0, time.UTC); !v.Equal(exp) {
+		t.Fatalf("unexpected boundary: %s", v)
+	}
+
+	if v, err := ticker.NextBoundary(time.Date(2000, time.January, 1, 9, 15, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	} else if exp := time.Date(2000, time.January, 1, 9, 30, 0, 0, time.UTC); !v.Equal(exp) {
+		t.Fatalf("unexpected boundary: %s", v)
+	}
+}
+
+// Ensure finding the next boundary without commands returns an error.
+func TestTicker_NextBoundary_ErrNoCommands(t *testing.T) {
+	if _, err := boxer.NewTicker().NextBoundary(time.Now()); err == nil || err.Error() != "no commands" {
+		t.Fatal(err)
+	}
+}
+
+// Ensure handlers are not executed outside of the schedule.
+func TestTicker_Tick_Schedule(t *testing.T) {
+	var calls []int
+	ticker := boxer.NewTicker()
+	ticker.Schedule = &boxer.Schedule{Start: 9 * time.Hour, End: 17 * time.Hour}
+	ticker.Commands = []boxer.Command{{
+		Step:     1 * time.Minute,
+		Interval: 15 * time.Minute,
+		Handler: func(i, n int) error {
+			calls = append(calls, i)
+			return nil
+		},
+	}}
+
+	for _, now := range []time.Time{
+		time.Date(2000, time.January, 1, 8, 58, 0, 0, time.UTC),
+		time.Date(2000, time.January, 1, 8, 59, 0, 0, time.UTC),
+		time.Date(2000, time.January, 1, 9, 0, 0, 0, time.UTC),
+		time.Date(2000, time.January, 1, 9, 1, 0, 0, time.UTC),
+		time.Date(2000, time.January, 1, 17, 0, 0, 0, time.UTC),
+	} {
+		if errs := ticker.TickAt(now); len(errs) > 0 {
+			t.Fatal(errs)
+		}
+	}
+
+	if !reflect.DeepEqual(calls, []int{0, 1}) {
+		t.Fatalf("unexpected calls: %v", calls)
+	}
+}
+
+// Ensure handlers are not executed on days outside of the schedule.
+func TestTicker_Tick_ScheduleDays(t *testing.T) {
+	days, err := boxer.ParseWeekdays([]string{"mon", "TUE", "Wed", "thu", "fri"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls int
+	ticker := boxer.NewTicker()
+	ticker.Schedule = &boxer.Schedule{Days: days}
+	ticker.Commands = []boxer.Command{{
+		Interval: 1 * time.Hour,
+		Handler:  func(i, n int) error { calls++; return nil },
+	}}
+
+	// January 1st, 2000 is a Saturday.
+	if errs := ticker.TickAt(time.Date(2000, time.January, 1, 9, 0, 0, 0, time.UTC)); len(errs) > 0 {
+		t.Fatal(errs)
+	} else if calls != 0 {
+		t.Fatalf("unexpected call count: %d", calls)
+	}
+
+	// January 3rd, 2000 is a Monday.
+	if errs := ticker.TickAt(time.Date(2000, time.January, 3, 9, 0, 0, 0, time.UTC)); len(errs) > 0 {
+		t.Fatal(errs)
+	} else if calls != 1 {
+		t.Fatalf("unexpected call count: %d", calls)
+	}
+}
+
+// Ensure an unknown weekday returns an error.
+func TestParseWeekdays_ErrInvalid(t *testing.T) {
+	if _, err := boxer.ParseWeekdays([]string{"mon", "funday"}); err == nil || err.Error() != `invalid weekday: "funday"` {
+		t.Fatal(err)
+	}
+}
+
+// Ensure a schedule can cross midnight.
+func TestSchedule_Active(t *testing.T) {
+	s, err := boxer.ActiveBetween("10:00pm", "6:00am")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		hour, min int
+		exp       bool
+	}{
+		{hour: 21, min: 59, exp: false},
+		{hour: 22, min: 0, exp: true},
+		{hour: 0, min: 0, exp: true},
+		{hour: 5, min: 59, exp: true},
+		{hour: 6, min: 0, exp: false},
+		{hour: 12, min: 0, exp: false},
+	} {
+		if v := s.Active(time.Date(2000, time.January, 1, tt.hour, tt.min, 0, 0, time.UTC)); v != tt.exp {
+			t.Fatalf("%02d:%02d: unexpected result: %v", tt.hour, tt.min, v)
+		}
+	}
+}
+
+// Ensure an invalid schedule time returns an error.
+func TestActiveBetween_ErrInvalid(t *testing.T) {
+	if _, err := boxer.ActiveBetween("9:00am", "bad"); err == nil || err.Error() != `parse end: parsing time "bad" as "3:04pm": cannot parse "bad" as "3"` {
+		t.Fatal(err)
+	}
+}
+
+// Ensure the status reports each command's position within its interval.
+func TestTicker_Status(t *testing.T) {
+	ticker := boxer.NewTicker()
+	ticker.Commands = []boxer.Command{
+		{Name: "a", Step: 1 * time.Minute, Interval: 15 * time.Minute},
+		{Name: "b", Interval: 1 * time.Hour, Offset: 10 * time.Second},
+	}
+
+	a := ticker.Status(time.Date(2000, time.January, 1, 9, 6, 30, 0, time.UTC))
+	if !reflect.DeepEqual(a, []boxer.CommandStatus{
+		{Name: "a", I: 6, N: 15, Pct: 0.4, NextBoundary: time.Date(2000, time.January, 1, 9, 15, 0, 0, time.UTC)},
+		{Name: "b", I: 0, N: 1, Pct: 0, NextBoundary: time.Date(2000, time.January, 1, 10, 0, 10, 0, time.UTC)},
+	}) {
+		t.Fatalf("unexpected status: %+v", a)
+	}
+}
+
+// Ensure commands with an offset execute after the step boundary.
+func TestTicker_Tick_Offset(t *testing.T) {
+	var calls []string
+	now := time.Date(2000, time.January, 1, 0, 0, 30, 0, time.UTC)
+	ticker := boxer.NewTicker()
+	ticker.Now = func() time.Time { return now }
+	ticker.Commands = append(ticker.Commands, boxer.Command{
+		Name:     "wallpaper",
+		Interval: 1 * time.Minute,
+		Handler:  func(i, n int) error { calls = append(calls, now.Format("wallpaper@15:04:05")); return nil },
+	}, boxer.Command{
+		Name:     "sound",
+		Interval: 1 * time.Minute,
+		Offset:   2 * time.Second,
+		Handler:  func(i, n int) error { calls = append(calls, now.Format("sound@15:04:05")); return nil },
+	})
+
+	// Tick every second across the next minute boundary.
+	for ; now.Before(time.Date(2000, time.January, 1, 0, 1, 5, 0, time.UTC)); now = now.Add(1 * time.Second) {
+		ticker.Tick()
+	}
+
+	if !reflect.DeepEqual(calls, []string{
+		"wallpaper@00:00:30", "sound@00:00:30",
+		"wallpaper@00:01:00",
+		"sound@00:01:02",
+	}) {
+		t.Fatalf("unexpected calls: %v", calls)
+	}
+}
+
+// Ensure commands with a minimum tick interval are checked less frequently.
+func TestTicker_Tick_MinTickInterval(t *testing.T) {
+	ticker := boxer.NewTicker()
+
+	var fineN, coarseN int
+	ticker.Commands = []boxer.Command{
+		{Step: 1 * time.Minute, Interval: 15 * time.Minute, Handler: func(i, n int) error { fineN++; return nil }},
+		{Step: 1 * time.Minute, Interval: 15 * time.Minute, MinTickInterval: 5 * time.Minute, Handler: func(i, n int) error { coarseN++; return nil }},
+	}
+	if d := ticker.MinTickInterval(); d != 0 {
+		t.Fatalf("unexpected min tick interval: %s", d)
+	}
+
+	// Tick every minute for 30 minutes.
+	start := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	for i := time.Duration(0); i <= 30*time.Minute; i += time.Minute {
+		ticker.Now = func() time.Time { return start.Add(i) }
+		ticker.Tick()
+	}
+
+	if fineN != 31 {
+		t.Fatalf("unexpected fine count: %d", fineN)
+	} else if coarseN != 7 {
+		t.Fatalf("unexpected coarse count: %d", coarseN)
+	}
+}
+
+// Ensure the ticker restarts intervals after a long gap between ticks.
+func TestTicker_Tick_SleepThreshold(t *testing.T) {
+	ticker := boxer.NewTicker()
+	ticker.SleepThreshold = 10 * time.Minute
+
+	var steps []int
+	ticker.Commands = append(ticker.Commands, boxer.Command{
+		Step:     1 * time.Minute,
+		Interval: 15 * time.Minute,
+		Handler:  func(i, n int) error { steps = append(steps, i); return nil },
+	})
+
+	// Tick normally and then jump forward as if the machine was asleep.
+	now := time.Date(2000, time.January, 1, 0, 5, 0, 0, time.UTC)
+	ticker.Now = func() time.Time { return now }
+	ticker.Tick()
+
+	now = now.Add(2*time.Hour + 2*time.Minute + 30*time.Second)
+	ticker.Tick()
+
+	now = now.Add(1 * time.Minute)
+	ticker.Tick()
+
+	if !reflect.DeepEqual(steps, []int{5, 0, 1}) {
+		t.Fatalf("unexpected steps: %v", steps)
+	}
+}
+
+// Ensure waking from sleep does not overwrite the configured anchor.
+func TestTicker_Tick_SleepThreshold_Anchor(t *testing.T) {
+	anchor := time.Date(2000, time.January, 1, 0, 3, 0, 0, time.UTC)
+	ticker := boxer.NewTicker()
+	ticker.Anchor = anchor
+	ticker.SleepThreshold = 10 * time.Minute
+
+	var steps []int
+	ticker.Commands = append(ticker.Commands, boxer.Command{
+		Step:     1 * time.Minute,
+		Interval: 15 * time.Minute,
+		Handler:  func(i, n int) error { steps = append(steps, i); return nil },
+	})
+
+	now := time.Date(2000, time.January, 1, 0, 5, 0, 0, time.UTC)
+	ticker.Now = func() time.Time { return now }
+	ticker.Tick()
+
+	now = now.Add(2*time.Hour + 2*time.Minute + 30*time.Second)
+	ticker.Tick()
+
+	if !reflect.DeepEqual(steps, []int{2, 0}) {
+		t.Fatalf("unexpected steps: %v", steps)
+	} else if !ticker.Anchor.Equal(anchor) {
+		t.Fatalf("unexpected anchor: %s", ticker.Anchor)
+	}
+}
+
+// Ensure handler run time is not counted against the sleep threshold.
+func TestTicker_Tick_SleepThreshold_SlowHandler(t *testing.T) {
+	ticker := boxer.NewTicker()
+	ticker.SleepThreshold = 1 * time.Minute
+
+	var steps []int
+	ticker.Commands = append(ticker.Commands, boxer.Command{
+		Step:     1 * time.Minute,
+		Interval: 15 * time.Minute,
+		Handler: func(i, n int) error {
+			steps = append(steps, i)
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		},
+	})
+
+	// The next tick starts just over the threshold after the previous tick
+	// started but within the threshold of when it finished.
+	now := time.Date(2000, time.January, 1, 0, 5, 30, 0, time.UTC)
+	ticker.Now = func() time.Time { return now }
+	ticker.Tick()
+
+	now = now.Add(1*time.Minute + 10*time.Millisecond)
+	ticker.Tick()
+
+	if !reflect.DeepEqual(steps, []int{5, 6}) {
+		t.Fatalf("unexpected steps: %v", steps)
+	}
+}
+
+// Ensure the tick hook is called once per tick before handlers execute.
+func TestTicker_Tick_OnTick(t *testing.T) {
+	var events []string
+	now := time.Date(2000, time.January, 1, 0, 3, 0, 0, time.UTC)
+	ticker := boxer.NewTicker()
+	ticker.Now = func() time.Time { return now }
+	ticker.OnTick = func(v time.Time) {
+		if !v.Equal(now) {
+			t.Fatalf("unexpected time: %s", v)
+		}
+		events = append(events, "tick")
+	}
+	ticker.Commands = append(ticker.Commands, boxer.Command{
+		Step:     1 * time.Minute,
+		Interval: 4 * time.Minute,
+		Handler:  func(i, n int) error { events = append(events, "handler"); return nil },
+	})
+	ticker.Tick()
+	ticker.Tick()
+
+	if !reflect.DeepEqual(events, []string{"tick", "handler", "tick"}) {
+		t.Fatalf("unexpected events: %v", events)
+	}
+}
+
+// Ensure the ticker records spans for ticks and handler execution.
+func TestTicker_Tick_Tracer(t *testing.T) {
+	var tracer Tracer
+	ticker := boxer.NewTicker()
+	ticker.Tracer = &tracer
+	ticker.Now = func() time.Time { return time.Date(2000, time.January, 1, 0, 3, 0, 0, time.UTC) }
+	ticker.Commands = append(ticker.Commands, boxer.Command{
+		Name:     "wallpaper",
+		Step:     1 * time.Minute,
+		Interval: 4 * time.Minute,
+		Handler:  func(i, n int) error { return errors.New("marker") },
+	})
+	ticker.Logger = log.New(ioutil.Discard, "", 0)
+	ticker.Tick()
+
+	// Verify the tick & handler spans were recorded.
+	if len(tracer.Spans) != 2 {
+		t.Fatalf("unexpected span count: %d", len(tracer.Spans))
+	} else if s := tracer.Spans[0]; s.Name != "tick" || !s.Ended {
+		t.Fatalf("unexpected tick span: %#v", s)
+	} else if s := tracer.Spans[1]; s.Name != "handler" || !s.Ended || s.Err == nil || s.Err.Error() != "marker" {
+		t.Fatalf("unexpected handler span: %#v", s)
+	} else if s.Parent != tracer.Spans[0] {
+		t.Fatalf("unexpected handler parent: %#v", s.Parent)
+	} else if !reflect.DeepEqual(s.Attrs, map[string]interface{}{"command": "wallpaper", "step": 3, "total": 4, "pct": 0.75}) {
+		t.Fatalf("unexpected handler attributes: %#v", s.Attrs)
+	}
+}
+
+// Ensure handler spans are children of their own tick's span across ticks.
+func TestTicker_Tick_Tracer_Parent(t *testing.T) {
+	var tracer Tracer
+	now := time.Date(2000, time.January, 1, 0, 3, 0, 0, time.UTC)
+	ticker := boxer.NewTicker()
+	ticker.Tracer = &tracer
+	ticker.Now = func() time.Time { return now }
+	ticker.Commands = append(ticker.Commands,
+		boxer.Command{Name: "a", Step: 1 * time.Minute, Interval: 4 * time.Minute, Handler: func(i, n int) error { return nil }},
+		boxer.Command{Name: "b", Step: 1 * time.Minute, Interval: 4 * time.Minute, Handler: func(i, n int) error { return nil }},
+	)
+	ticker.Logger = log.New(ioutil.Discard, "", 0)
+	ticker.Tick()
+	now = now.Add(1 * time.Minute)
+	ticker.Tick()
+
+	// Verify each tick's handler spans point at that tick.
+	var ticks []*Span
+	children := make(map[*Span]int)
+	for _, s := range tracer.Spans {
+		if s.Name == "tick" {
+			if s.Parent != nil {
+				t.Fatalf("unexpected tick parent: %#v", s.Parent)
+			}
+			ticks = append(ticks, s)
+		} else {
+			children[s.Parent]++
+		}
+	}
+	if len(ticks) != 2 {
+		t.Fatalf("unexpected tick count: %d", len(ticks))
+	} else if children[ticks[0]] != 2 || children[ticks[1]] != 2 || len(children) != 2 {
+		t.Fatalf("unexpected children: %v", children)
+	}
+}
+
+// Ensure the ticker counts ticks, completed intervals & handler errors.
+func TestTicker_Tick_Metrics(t *testing.T) {
+	var metrics Metrics
+	now := time.Date(2000, time.January, 1, 0, 2, 0, 0, time.UTC)
+	ticker := boxer.NewTicker()
+	ticker.Metrics = &metrics
+	ticker.Now = func() time.Time { return now }
+	ticker.Logger = log.New(ioutil.Discard, "", 0)
+	ticker.Commands = append(ticker.Commands, boxer.Command{
+		Name:     "wallpaper",
+		Step:     1 * time.Minute,
+		Interval: 4 * time.Minute,
+		Handler:  func(i, n int) error { return nil },
+	}, boxer.Command{
+		Name:     "broken",
+		Interval: 1 * time.Minute,
+		Handler:  func(i, n int) error { return errors.New("marker") },
+	})
+
+	// Tick through the last step of the interval & the start of the next.
+	for i := 0; i < 3; i++ {
+		ticker.Tick()
+		now = now.Add(1 * time.Minute)
+	}
+
+	if metrics.Ticks != 3 {
+		t.Fatalf("unexpected ticks: %d", metrics.Ticks)
+	} else if !reflect.DeepEqual(metrics.Intervals, []string{"broken", "wallpaper", "broken", "broken"}) {
+		t.Fatalf("unexpected intervals: %v", metrics.Intervals)
+	} else if !reflect.DeepEqual(metrics.Errors, []string{"broken", "broken", "broken"}) {
+		t.Fatalf("unexpected errors: %v", metrics.Errors)
+	}
+}
+
+// Ensure OnInterval only calls the wrapped handler on the first step.
+func TestOnInterval(t *testing.T) {
+	var calls [][2]int
+	h := boxer.OnInterval(func(i, n int) error {
+		calls = append(calls, [2]int{i, n})
+		return nil
+	})
+	for i := 0; i < 4; i++ {
+		if err := h(i, 4); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(calls, [][2]int{{0, 4}}) {
+		t.Fatalf("unexpected calls: %v", calls)
+	}
+}
+
+// Ensure OnIntervalEnd only calls the wrapped handler on the final step.
+func TestOnIntervalEnd(t *testing.T) {
+	var calls [][2]int
+	h := boxer.OnIntervalEnd(func(i, n int) error {
+		calls = append(calls, [2]int{i, n})
+		return errors.New("marker")
+	})
+	for i := 0; i < 4; i++ {
+		if err := h(i, 4); i == 3 && (err == nil || err.Error() != "marker") {
+			t.Fatal(err)
+		} else if i != 3 && err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(calls, [][2]int{{3, 4}}) {
+		t.Fatalf("unexpected calls: %v", calls)
+	}
+}
+
+// Ensure handler errors are logged but not returned.
+func TestIgnoreErrors(t *testing.T) {
+	var buf bytes.Buffer
+	h := boxer.IgnoreErrors(log.New(&buf, "", 0), func(i, n int) error {
+		return errors.New("marker")
+	})
+	if err := h(0, 4); err != nil {
+		t.Fatal(err)
+	} else if buf.String() != "ignored error: marker\n" {
+		t.Fatalf("unexpected log: %s", buf.String())
+	}
+}
+
+// Ensure the percent complete is zero when there are no steps.
+func TestPercent(t *testing.T) {
+	if v := boxer.Percent(1, 4); v != 0.25 {
+		t.Fatalf("unexpected pct: %v", v)
+	} else if v := boxer.Percent(1, 0); v != 0 {
+		t.Fatalf("unexpected pct: %v", v)
+	} else if v := boxer.Percent(1, -2); v != 0 {
+		t.Fatalf("unexpected pct: %v", v)
+	}
+}
+
+// Ensure HandlerFunc passes the percent complete to the callback.
+func TestHandlerFunc(t *testing.T) {
+	var pcts []float64
+	h := boxer.HandlerFunc(func(pct float64) error {
+		pcts = append(pcts, pct)
+		return nil
+	})
+
+	for _, v := range [][2]int{{0, 4}, {1, 4}, {3, 4}, {5, 10}} {
+		if err := h(v[0], v[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(pcts, []float64{0, 0.25, 0.75, 0.5}) {
+		t.Fatalf("unexpected pcts: %v", pcts)
+	}
+}
+
+// Ensure HandlerFunc returns the error from the callback.
+func TestHandlerFunc_Err(t *testing.T) {
+	h := boxer.HandlerFunc(func(pct float64) error { return errors.New("marker") })
+	if err := h(1, 2); err == nil || err.Error() != "marker" {
+		t.Fatal(err)
+	}
+}
+
+// Ensure the overlay handler writes a progress frame for each step.
+func TestOverlayHandler(t *testing.T) {
+	var buf bytes.Buffer
+	h := boxer.NewOverlayHandler(&buf)
+	for i := 0; i < 4; i++ {
+		if err := h(i, 4); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if buf.String() != `{"i":0,"n":4,"pct":0}`+"\n"+
+		`{"i":1,"n":4,"pct":0.25}`+"\n"+
+		`{"i":2,"n":4,"pct":0.5}`+"\n"+
+		`{"i":3,"n":4,"pct":0.75}`+"\n" {
+		t.Fatalf("unexpected frames:\n\n%s", buf.String())
+	}
+}
+
+// Ensure closing the overlay helper waits for the process to exit.
+func TestStartOverlayHelper(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The helper only finishes writing its output after stdin is closed.
+	path := filepath.Join(dir, "frames")
+	w, err := boxer.StartOverlayHelper("/bin/sh", "-c", "cat > "+path)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := boxer.NewOverlayHandler(w)(1, 4); err != nil {
+		t.Fatal(err)
+	} else if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err := ioutil.ReadFile(path); err != nil {
+		t.Fatal(err)
+	} else if string(b) != `{"i":1,"n":4,"pct":0.25}`+"\n" {
+		t.Fatalf("unexpected frames: %q", b)
+	}
+}
+
+// Ensure a command with an interval that is a multiple of the step is valid.
+func TestCommand_Validate(t *testing.T) {
+	for i, cmd := range []boxer.Command{
+		{Step: 1 * time.Minute, Interval: 15 * time.Minute},
+		{Step: 5 * time.Minute, Interval: 5 * time.Minute},
+		{Interval: 30 * time.Minute},
+	} {
+		if err := cmd.Validate(); err != nil {
+			t.Errorf("%d. unexpected error: %s", i, err)
+		}
+	}
+}
+
+// Ensure a command with an interval that is not a multiple of the step is invalid.
+func TestCommand_Validate_ErrNotMultiple(t *testing.T) {
+	cmd := boxer.Command{Step: 7 * time.Minute, Interval: 15 * time.Minute}
+	if err := cmd.Validate(); err == nil || err.Error() != `interval must be a multiple of step: 15m0s / 7m0s` {
+		t.Fatal(err)
+	}
+}
+
+// Ensure a command without a positive interval is invalid.
+func TestCommand_Validate_ErrInterval(t *testing.T) {
+	cmd := boxer.Command{Step: 1 * time.Minute}
+	if err := cmd.Validate(); err == nil || err.Error() != `interval must be positive: 0s` {
+		t.Fatal(err)
+	}
+}
+
+// Ensure the socket handler writes frames and reconnects after a failure.
+func TestSocketHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "boxer.sock")
+
+	// Return an error while the socket is unavailable.
+	h := &boxer.SocketHandler{Path: path}
+	defer h.Close()
+	if err := h.Handle(0, 4); err == nil || !strings.HasPrefix(err.Error(), "dial socket: ") {
+		t.Fatal(err)
+	}
+
+	// Start listening & read a frame from the next connection.
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	lines := make(chan string)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	if err := h.Handle(1, 4); err != nil {
+		t.Fatal(err)
+	} else if line := <-lines; line != `{"i":1,"n":4,"pct":0.25}` {
+		t.Fatalf("unexpected frame: %s", line)
+	}
+}
+
+// Ensure the console handler writes a progress bar with the remaining time.
+func TestConsoleHandler(t *testing.T) {
+	var buf bytes.Buffer
+	h := boxer.NewConsoleHandler(&buf, 1*time.Minute, boxer.TextOptions{})
+	if err := h(0, 14); err != nil {
+		t.Fatal(err)
+	} else if err := h(7, 14); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != "\r[----------] 0% (14m left)\r[#####-----] 50% (7m left)" {
+		t.Fatalf("unexpected output: %q", buf.String())
+	}
+}
+
+// Ensure the console handler rounds the remaining time using the rounding method.
+func TestConsoleHandler_Rounding(t *testing.T) {
+	var buf bytes.Buffer
+	if err := boxer.NewConsoleHandler(&buf, 30*time.Second, boxer.TextOptions{Rounding: boxer.RoundCeil})(0, 3); err != nil {
+		t.Fatal(err)
+	} else if buf.String() != "\r[----------] 0% (2m left)" {
+		t.Fatalf("unexpected output: %q", buf.String())
+	}
+}
+
+// Ensure the iTerm badge handler emits the badge escape sequence.
+func TestITermBadgeHandler(t *testing.T) {
+	var buf bytes.Buffer
+	if err := boxer.NewITermBadgeHandler(&buf, 1*time.Minute, boxer.TextOptions{})(3, 15); err != nil {
+		t.Fatal(err)
+	} else if buf.String() != "\x1b]1337;SetBadgeFormat=MTJt\a" {
+		t.Fatalf("unexpected output: %q", buf.String())
+	}
+}
+
+// Ensure the status text size grows toward the end of the interval.
+func TestStatusTextHandler(t *testing.T) {
+	f, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	h := boxer.NewStatusTextHandler(f.Name(), 1*time.Minute, boxer.TextOptions{MinFontSize: 12, MaxFontSize: 24})
+	for i, exp := range []string{"4m left | size=12\n", "3m left | size=15\n", "2m left | size=18\n", "1m left | size=21\n"} {
+		if err := h(i, 4); err != nil {
+			t.Fatal(err)
+		} else if b, err := ioutil.ReadFile(f.Name()); err != nil {
+			t.Fatal(err)
+		} else if string(b) != exp {
+			t.Fatalf("%d. unexpected contents: %q", i, b)
+		}
+	}
+}
+
+// Ensure the status text omits the size parameter when no max size is set.
+func TestStatusTextHandler_NoSize(t *testing.T) {
+	f, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	if err := boxer.NewStatusTextHandler(f.Name(), 1*time.Minute, boxer.TextOptions{})(0, 3); err != nil {
+		t.Fatal(err)
+	} else if b, err := ioutil.ReadFile(f.Name()); err != nil {
+		t.Fatal(err)
+	} else if string(b) != "3m left\n" {
+		t.Fatalf("unexpected contents: %q", b)
+	}
+}
+
+// Ensure the task file contains the label during the interval and is cleared at the end.
+func TestTaskFileHandler(t *testing.T) {
+	f, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	h := boxer.NewTaskFileHandler(f.Name(), func(index int) string { return fmt.Sprintf("task #%d", index) })
+	for j, exp := range []string{"task #0\n", "task #0\n", "", "task #1\n"} {
+		if err := h(j%3, 3); err != nil {
+			t.Fatal(err)
+		} else if b, err := ioutil.ReadFile(f.Name()); err != nil {
+			t.Fatal(err)
+		} else if string(b) != exp {
+			t.Fatalf("%d. unexpected contents: %q", j, b)
+		}
+	}
+}
+
+// Ensure a single-step interval clears the task file instead of leaving a
+// stale label behind.
+func TestTaskFileHandler_SingleStep(t *testing.T) {
+	f, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err := f.WriteString("stale\n"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	h := boxer.NewTaskFileHandler(f.Name(), func(index int) string { return fmt.Sprintf("task #%d", index) })
+	if err := h(0, 1); err != nil {
+		t.Fatal(err)
+	} else if b, err := ioutil.ReadFile(f.Name()); err != nil {
+		t.Fatal(err)
+	} else if len(b) != 0 {
+		t.Fatalf("unexpected contents: %q", b)
+	}
+
+	// Verify the interval is still counted.
+	if err := h(0, 3); err != nil {
+		t.Fatal(err)
+	} else if b, err := ioutil.ReadFile(f.Name()); err != nil {
+		t.Fatal(err)
+	} else if string(b) != "task #1\n" {
+		t.Fatalf("unexpected contents: %q", b)
+	}
+}
+
+// Ensure the exec handler substitutes step placeholders into the arguments.
+func TestExecHandler(t *testing.T) {
+	var args []string
+	exec := func(name string, a []string, stdin io.Reader) ([]byte, error) {
+		if name != "/usr/local/bin/bulbs" {
+			t.Fatalf("unexpected name: %s", name)
+		}
+		args = a
+		return nil, nil
+	}
+
+	if err := boxer.NewExecHandler(exec, "/usr/local/bin/bulbs", []string{"--step={i}/{n}", "{pct}"})(1, 4); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(args, []string{"--step=1/4", "0.25"}) {
+		t.Fatalf("unexpected args: %v", args)
+	}
+}
+
+// Ensure the exec handler returns an error when the program fails.
+func TestExecHandler_Err(t *testing.T) {
+	exec := func(name string, a []string, stdin io.Reader) ([]byte, error) {
+		return []byte("no bulbs found\n"), errors.New("exit status 1")
+	}
+
+	if err := boxer.NewExecHandler(exec, "bulbs", nil)(0, 4); err == nil || err.Error() != "exec bulbs: exit status 1: no bulbs found" {
+		t.Fatal(err)
+	}
+}
+
 // Ensure the default command executor can execute and return the output.
 func TestDefaultCommandExecutor(t *testing.T) {
 	if runtime.GOOS == "windows" {
@@ -67,6 +1288,194 @@ func TestDefaultCommandExecutor(t *testing.T) {
 	}
 }
 
+// Ensure the default command executor allows a nil stdin.
+func TestDefaultCommandExecutor_NilStdin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+
+	b, err := boxer.DefaultCommandExecutor("cat", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(b) != 0 {
+		t.Fatalf("unexpected output: %s", b)
+	}
+}
+
+// Ensure the dry run executor logs commands instead of executing them.
+func TestDryRunCommandExecutor(t *testing.T) {
+	var buf bytes.Buffer
+	exec := boxer.NewDryRunCommandExecutor(log.New(&buf, "", 0))
+
+	if b, err := exec("/usr/bin/osascript", []string{"-l", "JavaScript"}, strings.NewReader("delay(1);")); err != nil {
+		t.Fatal(err)
+	} else if b != nil {
+		t.Fatalf("unexpected output: %s", b)
+	} else if buf.String() != "exec: /usr/bin/osascript -l JavaScript\ndelay(1);\n" {
+		t.Fatalf("unexpected log: %q", buf.String())
+	}
+}
+
+// Ensure the logging executor logs each command and its result.
+func TestWithLogging(t *testing.T) {
+	var buf bytes.Buffer
+	exec := boxer.WithLogging(func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		if name == "/usr/bin/false" {
+			return nil, errors.New("exit status 1")
+		}
+		return []byte("out"), nil
+	}, log.New(&buf, "", 0))
+
+	if b, err := exec("/usr/bin/defaults", []string{"read", "NSGlobalDomain"}, strings.NewReader("secret")); err != nil {
+		t.Fatal(err)
+	} else if string(b) != "out" {
+		t.Fatalf("unexpected output: %s", b)
+	} else if _, err := exec("/usr/bin/false", nil, nil); err == nil || err.Error() != "exit status 1" {
+		t.Fatal(err)
+	}
+
+	if buf.String() != "exec: /usr/bin/defaults read NSGlobalDomain\n"+
+		"exit: /usr/bin/defaults: ok\n"+
+		"exec: /usr/bin/false\n"+
+		"exit: /usr/bin/false: exit status 1\n" {
+		t.Fatalf("unexpected log: %q", buf.String())
+	}
+}
+
+// Ensure the retry executor re-executes until the command succeeds.
+func TestWithRetry(t *testing.T) {
+	var n int
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		n++
+		if b, _ := ioutil.ReadAll(stdin); string(b) != "script" {
+			t.Fatalf("unexpected stdin: %s", b)
+		} else if n < 3 {
+			return []byte("not ready"), errors.New("exit status 1")
+		}
+		return []byte("ok"), nil
+	}
+
+	b, err := boxer.WithRetry(exec, 5, 0)("osascript", nil, strings.NewReader("script"))
+	if err != nil {
+		t.Fatal(err)
+	} else if string(b) != "ok" {
+		t.Fatalf("unexpected output: %s", b)
+	} else if n != 3 {
+		t.Fatalf("unexpected attempts: %d", n)
+	}
+}
+
+// Ensure the retry executor passes a nil stdin through unchanged.
+func TestWithRetry_NilStdin(t *testing.T) {
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		if stdin != nil {
+			t.Fatal("expected nil stdin")
+		}
+		return nil, nil
+	}
+
+	if _, err := boxer.WithRetry(exec, 1, 0)("osascript", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure the retry executor executes the command once if attempts is not positive.
+func TestWithRetry_ZeroAttempts(t *testing.T) {
+	var n int
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		n++
+		return nil, errors.New("exit status 1")
+	}
+
+	if _, err := boxer.WithRetry(exec, 0, 0)("osascript", nil, nil); err == nil || err.Error() != "exit status 1" {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("unexpected exec count: %d", n)
+	}
+}
+
+// Ensure the retry executor returns the last error once attempts run out.
+func TestWithRetry_ErrAttempts(t *testing.T) {
+	var n int
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		n++
+		return []byte("not ready"), errors.New("exit status 1")
+	}
+
+	b, err := boxer.WithRetry(exec, 2, 0)("osascript", nil, nil)
+	if err == nil || err.Error() != "exit status 1" {
+		t.Fatal(err)
+	} else if string(b) != "not ready" {
+		t.Fatalf("unexpected output: %s", b)
+	} else if n != 2 {
+		t.Fatalf("unexpected attempts: %d", n)
+	}
+}
+
+// Ensure the remaining time is calculated from the start of the step.
+func TestRemainingTime(t *testing.T) {
+	if d := boxer.RemainingTime(8, 15, 1*time.Minute); d != 7*time.Minute {
+		t.Fatalf("unexpected remaining time: %s", d)
+	}
+}
+
+// Ensure the remaining time is rounded using each rounding method.
+func TestFormatRemaining(t *testing.T) {
+	d := 4*time.Minute + 30*time.Second
+	for i, tt := range []struct {
+		rounding string
+		result   string
+	}{
+		{rounding: "floor", result: "4m"},
+		{rounding: "ceil", result: "5m"},
+		{rounding: "round", result: "5m"},
+	} {
+		if r, err := boxer.ParseRounding(tt.rounding); err != nil {
+			t.Errorf("%d. unexpected error: %s", i, err)
+		} else if result := boxer.FormatRemaining(d, r); result != tt.result {
+			t.Errorf("%d. %s: unexpected result: %s", i, tt.rounding, result)
+		}
+	}
+}
+
+// Ensure each easing maps the fraction completed to the fraction drawn.
+func TestParseEasing(t *testing.T) {
+	for i, tt := range []struct {
+		easing string
+		pct    float64
+		result float64
+	}{
+		{easing: "", pct: 0.25, result: 0.25},
+		{easing: "linear", pct: 0.25, result: 0.25},
+		{easing: "ease_in", pct: 0.25, result: 0.0625},
+		{easing: "ease_out", pct: 0.25, result: 0.4375},
+		{easing: "ease_in_out", pct: 0.25, result: 0.125},
+		{easing: "ease_in_out", pct: 0.75, result: 0.875},
+	} {
+		if ease, err := boxer.ParseEasing(tt.easing); err != nil {
+			t.Errorf("%d. unexpected error: %s", i, err)
+		} else if result := ease(tt.pct); result != tt.result {
+			t.Errorf("%d. %s: unexpected result: %v", i, tt.easing, result)
+		} else if ease(0) != 0 || ease(1) != 1 {
+			t.Errorf("%d. %s: unexpected endpoints: %v, %v", i, tt.easing, ease(0), ease(1))
+		}
+	}
+}
+
+// Ensure an unknown easing returns an error.
+func TestParseEasing_ErrInvalid(t *testing.T) {
+	if _, err := boxer.ParseEasing("bounce"); err == nil || err.Error() != `invalid easing: "bounce"` {
+		t.Fatal(err)
+	}
+}
+
+// Ensure an unknown rounding method returns an error.
+func TestParseRounding_ErrInvalid(t *testing.T) {
+	if _, err := boxer.ParseRounding("up"); err == nil || err.Error() != `invalid rounding: "up"` {
+		t.Fatal(err)
+	}
+}
+
 // Ensure a color can be transposed from a to b by pct percent.
 func TestTransposeColor(t *testing.T) {
 	for i, tt := range []struct {
@@ -132,9 +1541,113 @@ func TestParseColor_WithoutHash(t *testing.T) {
 	}
 }
 
+// Ensure colors in the "#000" shorthand format can be parsed.
+func TestParseColor_Shorthand(t *testing.T) {
+	if c, err := boxer.ParseColor("#f00"); err != nil {
+		t.Fatal(err)
+	} else if c != (color.RGBA{R: 255, A: 255}) {
+		t.Fatalf("unexpected color: %#v", c)
+	}
+
+	if c, err := boxer.ParseColor("1aF"); err != nil {
+		t.Fatal(err)
+	} else if c != (color.RGBA{R: 0x11, G: 0xAA, B: 0xFF, A: 255}) {
+		t.Fatalf("unexpected color: %#v", c)
+	}
+}
+
+// Ensure named colors can be parsed regardless of case.
+func TestParseColor_Named(t *testing.T) {
+	if c, err := boxer.ParseColor("red"); err != nil {
+		t.Fatal(err)
+	} else if c != (color.RGBA{R: 255, A: 255}) {
+		t.Fatalf("unexpected color: %#v", c)
+	}
+
+	if c, err := boxer.ParseColor("White"); err != nil {
+		t.Fatal(err)
+	} else if c != (color.RGBA{R: 255, G: 255, B: 255, A: 255}) {
+		t.Fatalf("unexpected color: %#v", c)
+	}
+}
+
+// Ensure the contrast color is light for dark colors and dark for light colors.
+func TestContrastColor(t *testing.T) {
+	white, black := color.RGBA{255, 255, 255, 255}, color.RGBA{0, 0, 0, 255}
+	for _, tt := range []struct {
+		c   color.RGBA
+		exp color.RGBA
+	}{
+		{c: color.RGBA{0x16, 0x42, 0x5B, 0xFF}, exp: white},
+		{c: color.RGBA{0x00, 0x00, 0x00, 0xFF}, exp: white},
+		{c: color.RGBA{0xF9, 0xD5, 0x6E, 0xFF}, exp: black},
+		{c: color.RGBA{0x9A, 0xC9, 0x7C, 0xFF}, exp: black},
+	} {
+		if v := boxer.ContrastColor(tt.c); v != tt.exp {
+			t.Fatalf("%#v: unexpected color: %#v", tt.c, v)
+		}
+	}
+}
+
 // Ensure colors with an invalid format return an error.
 func TestParseColor_ErrInvalid(t *testing.T) {
 	if _, err := boxer.ParseColor("bad_color"); err == nil || err.Error() != `cannot parse color: "bad_color"` {
 		t.Fatal(err)
 	}
 }
+
+// Tracer is an in-memory implementation of boxer.Tracer.
+type Tracer struct {
+	Spans []*Span
+}
+
+func (t *Tracer) StartSpan(name string, attrs map[string]interface{}) boxer.Span {
+	s := &Span{tracer: t, Name: name, Attrs: attrs}
+	t.Spans = append(t.Spans, s)
+	return s
+}
+
+// Span is an in-memory implementation of boxer.Span.
+type Span struct {
+	tracer *Tracer
+	Parent *Span
+	Name   string
+	Attrs  map[string]interface{}
+	Ended  bool
+	Err    error
+}
+
+func (s *Span) StartSpan(name string, attrs map[string]interface{}) boxer.Span {
+	child := s.tracer.StartSpan(name, attrs).(*Span)
+	child.Parent = s
+	return child
+}
+
+func (s *Span) End(err error) { s.Ended, s.Err = true, err }
+
+// Restorable is a mock implementation of boxer.Restorable.
+type Restorable struct {
+	CaptureFn func() error
+	RestoreFn func() error
+}
+
+func (r *Restorable) Capture() error { return r.CaptureFn() }
+func (r *Restorable) Restore() error { return r.RestoreFn() }
+
+// Metrics is an in-memory implementation of boxer.Metrics.
+type Metrics struct {
+	Ticks     int
+	Intervals []string
+	Errors    []string
+}
+
+func (m *Metrics) IncTicks()                { m.Ticks++ }
+func (m *Metrics) IncIntervals(name string) { m.Intervals = append(m.Intervals, name) }
+func (m *Metrics) IncErrors(name string)    { m.Errors = append(m.Errors, name) }
+
+// Closer is a mock implementation of io.Closer.
+type Closer struct {
+	CloseFn func() error
+}
+
+func (c *Closer) Close() error { return c.CloseFn() }
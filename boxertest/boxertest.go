@@ -0,0 +1,109 @@
+// Package boxertest provides helpers for testing boxer handlers.
+//
+// A RecordingExecutor can be passed to any handler that takes a
+// boxer.CommandExecutor by using its Exec method:
+//
+//	e := boxertest.NewRecordingExecutor()
+//	e.Respond("/usr/local/bin/bulbs", []byte("bulb offline\n"), errors.New("exit status 1"))
+//
+//	h := boxer.NewExecHandler(e.Exec, "/usr/local/bin/bulbs", []string{"{pct}"})
+//	if err := h(0, 1); err == nil {
+//		t.Fatal("expected error")
+//	} else if calls := e.Calls(); len(calls) != 1 {
+//		t.Fatalf("unexpected calls: %v", calls)
+//	}
+package boxertest
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/benbjohnson/boxer"
+)
+
+// Call represents a single command execution.
+type Call struct {
+	Name  string
+	Args  []string
+	Stdin []byte // nil if no stdin was passed
+}
+
+// response represents the programmed result of executing a command.
+type response struct {
+	output []byte
+	err    error
+}
+
+// RecordingExecutor records every command it executes and returns programmed
+// responses. It is safe for concurrent use.
+type RecordingExecutor struct {
+	mu        sync.Mutex
+	calls     []Call
+	responses map[string]response
+
+	// Optional function called to produce the result of commands without a
+	// programmed response. If nil, those commands return no output.
+	ExecFunc boxer.CommandExecutor
+}
+
+// Ensure the Exec method can be used as a command executor.
+var _ boxer.CommandExecutor = (&RecordingExecutor{}).Exec
+
+// NewRecordingExecutor returns a new instance of RecordingExecutor.
+func NewRecordingExecutor() *RecordingExecutor {
+	return &RecordingExecutor{
+		responses: make(map[string]response),
+	}
+}
+
+// Respond sets the output & error returned whenever the named command is executed.
+func (e *RecordingExecutor) Respond(name string, output []byte, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.responses[name] = response{output: output, err: err}
+}
+
+// Exec records the command and returns its programmed response.
+// The stdin reader is read fully so it can be inspected later.
+func (e *RecordingExecutor) Exec(name string, args []string, stdin io.Reader) ([]byte, error) {
+	call := Call{Name: name, Args: append([]string(nil), args...)}
+	if stdin != nil {
+		b, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			return nil, err
+		}
+		call.Stdin = b
+	}
+
+	e.mu.Lock()
+	e.calls = append(e.calls, call)
+	resp, ok := e.responses[name]
+	fn := e.ExecFunc
+	e.mu.Unlock()
+
+	if ok {
+		return resp.output, resp.err
+	} else if fn != nil {
+		if stdin != nil {
+			stdin = bytes.NewReader(call.Stdin)
+		}
+		return fn(name, args, stdin)
+	}
+	return nil, nil
+}
+
+// Calls returns a copy of the calls recorded so far.
+func (e *RecordingExecutor) Calls() []Call {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]Call(nil), e.calls...)
+}
+
+// Reset clears the recorded calls. Programmed responses are kept.
+func (e *RecordingExecutor) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.calls = nil
+}
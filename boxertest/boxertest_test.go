@@ -0,0 +1,86 @@
+package boxertest_test
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/benbjohnson/boxer"
+	"github.com/benbjohnson/boxer/boxertest"
+)
+
+// Ensure the executor records the name, args & stdin of every call.
+func TestRecordingExecutor_Exec(t *testing.T) {
+	e := boxertest.NewRecordingExecutor()
+	if _, err := e.Exec("/bin/echo", []string{"a", "b"}, nil); err != nil {
+		t.Fatal(err)
+	} else if _, err := e.Exec("/bin/cat", nil, strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls := e.Calls(); !reflect.DeepEqual(calls, []boxertest.Call{
+		{Name: "/bin/echo", Args: []string{"a", "b"}},
+		{Name: "/bin/cat", Stdin: []byte("hello")},
+	}) {
+		t.Fatalf("unexpected calls: %#v", calls)
+	}
+
+	e.Reset()
+	if calls := e.Calls(); len(calls) != 0 {
+		t.Fatalf("unexpected calls after reset: %#v", calls)
+	}
+}
+
+// Ensure programmed responses are returned by command name.
+func TestRecordingExecutor_Respond(t *testing.T) {
+	e := boxertest.NewRecordingExecutor()
+	e.Respond("/bin/date", []byte("noon\n"), nil)
+	e.Respond("/bin/false", []byte("failed\n"), errors.New("exit status 1"))
+
+	if b, err := e.Exec("/bin/date", nil, nil); err != nil {
+		t.Fatal(err)
+	} else if string(b) != "noon\n" {
+		t.Fatalf("unexpected output: %q", b)
+	}
+
+	if b, err := e.Exec("/bin/false", nil, nil); err == nil || err.Error() != "exit status 1" {
+		t.Fatal(err)
+	} else if string(b) != "failed\n" {
+		t.Fatalf("unexpected output: %q", b)
+	}
+
+	if b, err := e.Exec("/bin/true", nil, nil); err != nil || b != nil {
+		t.Fatalf("unexpected result: %q, %v", b, err)
+	}
+}
+
+// Ensure commands without a programmed response fall back to ExecFunc.
+func TestRecordingExecutor_ExecFunc(t *testing.T) {
+	e := boxertest.NewRecordingExecutor()
+	e.ExecFunc = func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		return []byte(strings.Join(args, ",")), nil
+	}
+
+	if b, err := e.Exec("/bin/echo", []string{"a", "b"}, nil); err != nil {
+		t.Fatal(err)
+	} else if string(b) != "a,b" {
+		t.Fatalf("unexpected output: %q", b)
+	}
+}
+
+// Ensure the executor can be passed to handlers.
+func TestRecordingExecutor_Handler(t *testing.T) {
+	e := boxertest.NewRecordingExecutor()
+	h := boxer.NewExecHandler(e.Exec, "/usr/local/bin/bulbs", []string{"{i}/{n}"})
+	if err := h(1, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls := e.Calls(); !reflect.DeepEqual(calls, []boxertest.Call{
+		{Name: "/usr/local/bin/bulbs", Args: []string{"1/4"}},
+	}) {
+		t.Fatalf("unexpected calls: %#v", calls)
+	}
+}
@@ -1,14 +1,33 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"hash/fnv"
 	"image/color"
+	"io"
 	"io/ioutil"
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
 	"os/user"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/BurntSushi/toml"
@@ -25,6 +44,16 @@ func main() {
 // DefaultTickInterval is the time between ticks on the ticker.
 const DefaultTickInterval = 1 * time.Second
 
+// DefaultSleepMargin is the time allowed beyond the tick interval before the
+// machine is considered to have been asleep.
+const DefaultSleepMargin = 1 * time.Minute
+
+// Retry settings for setting the wallpaper.
+const (
+	DefaultRetryAttempts = 3
+	DefaultRetryBackoff  = 500 * time.Millisecond
+)
+
 // Main represents the program execution.
 type Main struct {
 	// The time between tick execution on the Ticker.
@@ -33,9 +62,48 @@ type Main struct {
 	// The function used to execute OS commands.
 	Executor boxer.CommandExecutor
 
+	// The clock used by the run loop and the ticker.
+	Clock boxer.Clock
+
 	// The logger passed to the ticker during execution.
 	Logger *log.Logger
 
+	// The format of log output. Either "text" or "json".
+	LogFormat string
+
+	// If true, every command executed and the duration of every handler
+	// execution are logged.
+	Verbose bool
+
+	// Input used to read the configuration when the path is "-".
+	Stdin io.Reader
+
+	// Output used for reporting by subcommands.
+	Stdout io.Writer
+
+	// Returns the size of the desktop for subcommands.
+	DesktopSizer boxer.DesktopSizer
+
+	// The path to the configuration file.
+	// If blank, the default path is used.
+	ConfigPath string
+
+	// Overrides the work directory in the configuration file, if set.
+	WorkDir string
+
+	// The path of a JSON file that is replaced with the status of each
+	// command after every tick. If blank, no status file is written.
+	StatusPath string
+
+	mu      sync.Mutex
+	ticker  *boxer.Ticker
+	config  *Config // config used to build the current ticker
+	tempDir string
+	stdin   []byte // config read from stdin, reused between reloads
+	metrics *Metrics
+	stream  *StatusStream // broadcasts status after each tick, if serving
+	tracer  *OTLPTracer   // exports spans, if an otel endpoint is configured
+
 	closing chan struct{}
 }
 
@@ -44,7 +112,12 @@ func NewMain() *Main {
 	return &Main{
 		TickInterval: DefaultTickInterval,
 		Executor:     boxer.DefaultCommandExecutor,
+		Clock:        boxer.DefaultClock,
 		Logger:       log.New(os.Stderr, "", 0),
+		LogFormat:    "text",
+		Stdin:        os.Stdin,
+		Stdout:       os.Stdout,
+		DesktopSizer: boxer.PrimaryDesktopSize,
 
 		closing: make(chan struct{}, 0),
 	}
@@ -52,203 +125,2327 @@ func NewMain() *Main {
 
 // Run excutes the program.
 func (m *Main) Run(args []string) error {
+	// Dispatch to a subcommand, if one is specified.
+	if len(args) > 0 {
+		switch args[0] {
+		case "validate":
+			return m.RunValidate(args[1:])
+		case "bench":
+			return m.RunBench(args[1:])
+		case "simulate":
+			return m.RunSimulate(args[1:])
+		}
+	}
+
 	// Parse CLI arguments.
 	fs := flag.NewFlagSet("boxer", flag.ContinueOnError)
 	configPath := fs.String("config", "", "config path")
+	fs.StringVar(&m.WorkDir, "work-dir", m.WorkDir, "override the work_dir config setting")
+	dryRun := fs.Bool("dry-run", false, "log commands instead of executing them")
+	fs.StringVar(&m.LogFormat, "log-format", m.LogFormat, "log format (text or json)")
+	fs.BoolVar(&m.Verbose, "verbose", m.Verbose, "log every command executed and the duration of each handler execution")
+	metricsAddr := fs.String("metrics-addr", "", "serve prometheus metrics and a websocket status stream on this address")
+	once := fs.Bool("once", false, "run a single tick and exit")
+	fs.StringVar(&m.StatusPath, "status-file", m.StatusPath, "write command status as JSON to this path after each tick")
+	printConfig := fs.Bool("print-config", false, "print the effective configuration and exit")
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
 
-	// Read configuration file.
-	config, err := m.ReadConfig(*configPath)
-	if err != nil {
-		return fmt.Errorf("read config: %s", err)
+	// Write structured log lines, if requested.
+	switch m.LogFormat {
+	case "text":
+	case "json":
+		m.Logger = log.New(&JSONLogWriter{W: m.Logger.Writer(), Now: time.Now}, "", 0)
+	default:
+		return fmt.Errorf("invalid log format: %q", m.LogFormat)
+	}
+
+	// Print the effective configuration and exit, if requested.
+	if *printConfig {
+		return m.PrintConfig(*configPath)
+	}
+
+	// Log commands instead of executing them during a dry run.
+	if *dryRun {
+		m.Executor = boxer.NewDryRunCommandExecutor(m.Logger)
 	}
 
-	// Use a temp directory if no work directory is set.
-	if config.WorkDir == "" {
-		str, err := ioutil.TempDir("", "boxer-")
+	// Log every command for auditing, if requested.
+	if m.Verbose {
+		m.Executor = boxer.WithLogging(m.Executor, m.Logger)
+	}
+
+	// Serve metrics & the status stream until the program exits, if requested.
+	if *metricsAddr != "" {
+		ln, err := net.Listen("tcp", *metricsAddr)
 		if err != nil {
-			return fmt.Errorf("temp dir: %s", err)
+			return fmt.Errorf("metrics: %s", err)
 		}
-		config.WorkDir = str
+		defer ln.Close()
+
+		m.metrics = NewMetrics()
+		m.stream = NewStatusStream()
+		defer m.stream.Close()
+
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", m.metrics)
+		mux.Handle("/ws", m.stream)
+		go func() { _ = http.Serve(ln, mux) }()
 	}
 
-	// Create a new ticker based on the config.
-	ticker, err := NewTicker(config, m.Executor)
-	if err != nil {
-		return fmt.Errorf("cannot create ticker: %s", err)
+	// Read configuration file & create the ticker.
+	m.ConfigPath = *configPath
+	if err := m.Reload(); err != nil {
+		return err
+	}
+
+	// Execute a single tick and exit, if requested. System state is left as
+	// is so that the current step remains visible.
+	if *once {
+		return m.RunOnce()
 	}
 
 	// Notify user of the current settings.
-	log.Printf("Boxer running with %d commands...", len(ticker.Commands))
+	m.Logger.Printf("Boxer running with %d commands...", len(m.Ticker().Commands))
+
+	// Reload the configuration when a SIGHUP is received and shut down
+	// gracefully when an interrupt or SIGTERM is received.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	term := make(chan os.Signal, 1)
+	signal.Notify(term, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(hup)
+	defer signal.Stop(term)
 
 	// Begin ticking.
 	for {
-		ticker.Tick()
-		time.Sleep(m.TickInterval)
+		m.tick()
+
+		select {
+		case <-m.closing:
+			return m.Shutdown()
+		case <-term:
+			return m.Shutdown()
+		case <-hup:
+			if err := m.Reload(); err != nil {
+				m.Logger.Printf("reload: %s", err)
+				continue
+			}
+			m.Logger.Printf("Boxer reloaded with %d commands...", len(m.Ticker().Commands))
+		case <-m.Clock.After(m.tickInterval()):
+		}
 	}
 }
 
-// ReadConfig reads the configuration from a path.
-// If no path is provided then the default path is used.
-func (m *Main) ReadConfig(path string) (*Config, error) {
-	// If no path is provided then use the default path.
-	if path == "" {
-		str, err := DefaultConfigPath()
-		if err != nil {
-			return nil, fmt.Errorf("default config path: %s", err)
+// RunOnce executes a single tick on the current ticker and releases any
+// resources held by its handlers. Returns an error if any handler fails.
+func (m *Main) RunOnce() error {
+	t := m.Ticker()
+	errs := m.tick()
+	if err := t.Close(); err != nil {
+		m.Logger.Printf("close: %s", err)
+	}
+
+	if len(errs) > 0 {
+		a := make([]string, len(errs))
+		for i, err := range errs {
+			a[i] = err.Error()
 		}
-		path = str
+		return errors.New(strings.Join(a, "; "))
 	}
+	return nil
+}
 
-	// Decode file into config.
-	config := NewConfig()
-	if _, err := toml.DecodeFile(path, &config); err != nil {
-		return nil, err
+// tick executes the ticker and then writes the status file & broadcasts the
+// status to stream clients, if requested.
+func (m *Main) tick() []error {
+	now := m.Clock.Now()
+	errs := m.Ticker().TickAt(now)
+	if err := m.writeStatus(now); err != nil {
+		m.Logger.Printf("status: %s", err)
 	}
-	return config, nil
+	if err := m.broadcastStatus(now); err != nil {
+		m.Logger.Printf("stream: %s", err)
+	}
+	return errs
 }
 
-// DefaultConfigPath returns the default configuration path.
-// The default path is the "boxer.conf" file in the user's home directory.
-func DefaultConfigPath() (string, error) {
-	u, err := user.Current()
+// Status represents the contents of the status file.
+type Status struct {
+	Time     time.Time             `json:"time"`
+	Commands []boxer.CommandStatus `json:"commands"`
+}
+
+// status returns the JSON-encoded status of each command at now.
+func (m *Main) status(now time.Time) ([]byte, error) {
+	return json.Marshal(Status{Time: now, Commands: m.Ticker().Status(now)})
+}
+
+// writeStatus atomically replaces the status file with the status of each
+// command at now. The file is written to a temporary path and then renamed so
+// readers never see a partial file.
+func (m *Main) writeStatus(now time.Time) error {
+	if m.StatusPath == "" {
+		return nil
+	}
+
+	b, err := m.status(now)
 	if err != nil {
-		return "", err
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(m.StatusPath), ".boxer-status")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	} else if err := f.Close(); err != nil {
+		return err
 	}
-	return filepath.Join(u.HomeDir, "boxer.conf"), nil
+	return os.Rename(f.Name(), m.StatusPath)
 }
 
-// NewTicker creates a new ticker from configuration.
-func NewTicker(c *Config, exec boxer.CommandExecutor) (*boxer.Ticker, error) {
-	t := boxer.NewTicker()
+// broadcastStatus sends the status of each command at now to every client
+// connected to the status stream.
+func (m *Main) broadcastStatus(now time.Time) error {
+	if m.stream == nil {
+		return nil
+	}
 
-	if c.Wallpaper.Enabled {
-		// Parse times from config.
-		var times []time.Time
-		for _, s := range c.Wallpaper.Times {
-			t, err := time.Parse("3:04pm", s)
+	b, err := m.status(now)
+	if err != nil {
+		return err
+	}
+	m.stream.Broadcast(b)
+	return nil
+}
+
+// Reload reads the configuration file and replaces the current ticker with
+// a new ticker built from the configuration. The new ticker is used starting
+// with the next tick so in-flight handlers finish with the old configuration.
+func (m *Main) Reload() error {
+	// Read configuration file.
+	config, err := m.ReadConfig(m.ConfigPath)
+	if err != nil {
+		return fmt.Errorf("read config: %s", err)
+	}
+
+	// The work directory flag takes precedence over the config. Use a temp
+	// directory if no work directory is set. The same temp directory is
+	// reused between reloads.
+	if m.WorkDir != "" {
+		config.WorkDir = m.WorkDir
+	} else if config.WorkDir == "" {
+		if m.tempDir == "" {
+			str, err := ioutil.TempDir("", "boxer-")
 			if err != nil {
-				return nil, fmt.Errorf("parse wallpaper time: %s", err)
+				return fmt.Errorf("temp dir: %s", err)
 			}
-			times = append(times, t)
+			m.tempDir = str
 		}
+		config.WorkDir = m.tempDir
+	}
 
-		// Parse foreground color from config.
-		var foregrounds []color.RGBA
-		for _, s := range c.Wallpaper.Foregrounds {
-			c, err := boxer.ParseColor(s)
-			if err != nil {
-				return nil, fmt.Errorf("parse wallpaper foreground: %s", err)
-			}
-			foregrounds = append(foregrounds, c)
+	// Use the configured tick interval, if specified.
+	tickInterval := m.TickInterval
+	if config.TickInterval.Duration < 0 {
+		return fmt.Errorf("tick interval must be positive: %s", config.TickInterval)
+	} else if config.TickInterval.Duration > 0 {
+		tickInterval = config.TickInterval.Duration
+	}
+
+	// Create a new ticker based on the config using the main clock for the
+	// current time.
+	ticker, err := newTicker(config, m.Executor, m.Clock, m.Logger, false)
+	if err != nil {
+		return fmt.Errorf("cannot create ticker: %s", err)
+	}
+
+	// Report interval boundaries within one tick of the interval start.
+	ticker.TickInterval = tickInterval
+
+	// Restart intervals when waking from sleep. By default, the threshold is
+	// derived from the actual time between ticks plus a margin.
+	ticker.SleepThreshold = config.SleepThreshold.Duration
+	if ticker.SleepThreshold == 0 {
+		ticker.SleepThreshold = defaultSleepThreshold(ticker, tickInterval)
+	}
+
+	// Count ticker activity, if metrics are being served.
+	if m.metrics != nil {
+		ticker.Metrics = m.metrics
+	}
+
+	// Export spans to an OpenTelemetry collector, if configured. The tracer is
+	// reused between reloads unless the endpoint changes.
+	m.mu.Lock()
+	tracer := m.tracer
+	m.mu.Unlock()
+	if tracer != nil && tracer.Endpoint != config.OTel.Endpoint {
+		if err := tracer.Close(); err != nil {
+			m.Logger.Printf("otel: %s", err)
 		}
+		tracer = nil
+	}
+	if config.OTel.Endpoint != "" {
+		if tracer == nil {
+			tracer = NewOTLPTracer(config.OTel.Endpoint)
+			tracer.Logger = m.Logger
+		}
+		if config.OTel.ServiceName != "" {
+			tracer.ServiceName = config.OTel.ServiceName
+		}
+		ticker.Tracer = tracer
+	}
 
-		// Parse backgroun color from config.
-		var backgrounds []color.RGBA
-		for _, s := range c.Wallpaper.Backgrounds {
-			c, err := boxer.ParseColor(s)
-			if err != nil {
-				return nil, fmt.Errorf("parse wallpaper background: %s", err)
-			}
-			backgrounds = append(backgrounds, c)
+	// Report handler results through the main logger. In JSON mode, results
+	// are logged as structured entries and other ticker output is wrapped.
+	ticker.Verbose = m.Verbose
+	if m.LogFormat == "json" {
+		ticker.OnResult = m.logResult
+	}
+
+	// Swap in the new ticker and restore any state modified by the old one.
+	m.mu.Lock()
+	prev := m.ticker
+	m.ticker, m.config, m.tracer = ticker, config, tracer
+	m.mu.Unlock()
+	m.TickInterval = tickInterval
+
+	if prev != nil {
+		if err := prev.Restore(); err != nil {
+			m.Logger.Printf("restore: %s", err)
 		}
+		if err := prev.Close(); err != nil {
+			m.Logger.Printf("close: %s", err)
+		}
+	}
 
-		// Create a wallpaper generator.
-		generator, err := boxer.NewWallpaperGenerator(time.Now, times, foregrounds, backgrounds)
-		if err != nil {
-			return nil, fmt.Errorf("wallpaper generator: %s", err)
+	return nil
+}
+
+// Close signals the run loop to shut down.
+func (m *Main) Close() error {
+	close(m.closing)
+	return nil
+}
+
+// Shutdown restores any system state modified by the ticker's handlers,
+// releases any resources held by them and then runs the configured shutdown
+// command, if any.
+func (m *Main) Shutdown() error {
+	// Resources are closed even if restoring fails.
+	var a []string
+	if t := m.Ticker(); t != nil {
+		if err := t.Restore(); err != nil {
+			a = append(a, fmt.Sprintf("restore: %s", err))
+		}
+		if err := t.Close(); err != nil {
+			a = append(a, fmt.Sprintf("close: %s", err))
+		}
+	}
+	m.mu.Lock()
+	tracer := m.tracer
+	m.mu.Unlock()
+	if tracer != nil {
+		if err := tracer.Close(); err != nil {
+			a = append(a, fmt.Sprintf("otel: %s", err))
 		}
+	}
+	m.runShutdownCommand()
 
-		// Generate a new command.
-		t.Commands = append(t.Commands, boxer.Command{
-			Name:     "wallpaper",
-			Step:     c.Wallpaper.Step.Duration,
-			Interval: c.Wallpaper.Interval.Duration,
-			Handler: boxer.NewWallpaperHandler(
-				exec, boxer.DesktopSize, generator,
-				filepath.Join(c.WorkDir, "wallpaper"),
-			),
-		})
+	if len(a) > 0 {
+		return errors.New(strings.Join(a, "; "))
 	}
+	return nil
+}
 
-	if c.Announcement.Enabled {
-		t.Commands = append(t.Commands, boxer.Command{
-			Name:     "announcement",
-			Interval: c.Announcement.Interval.Duration,
-			Handler:  boxer.NewAnnouncementHandler(exec),
-		})
+// runShutdownCommand executes the configured shutdown command and logs its
+// output & any error.
+func (m *Main) runShutdownCommand() {
+	m.mu.Lock()
+	config := m.config
+	m.mu.Unlock()
+	if config == nil || config.ShutdownCommand == "" {
+		return
 	}
 
-	if c.MenuBar.Enabled {
-		t.Commands = append(t.Commands, boxer.Command{
-			Name:     "menu_bar",
-			Interval: c.MenuBar.Interval.Duration,
-			Handler:  boxer.NewMenuBarHandler(exec),
-		})
+	b, err := m.Executor(config.ShutdownCommand, config.ShutdownArgs, nil)
+	if b = bytes.TrimSpace(b); err != nil {
+		m.Logger.Printf("shutdown command: %s: %s", err, b)
+	} else if len(b) > 0 {
+		m.Logger.Printf("shutdown command: %s", b)
+	}
+}
+
+// logResult writes the result of a handler execution as a JSON log line.
+func (m *Main) logResult(name string, i, n int, err error) {
+	entry := LogEntry{
+		Timestamp: time.Now().UTC(),
+		Level:     "info",
+		Message:   fmt.Sprintf("step %d/%d", i+1, n),
+		Command:   name,
+	}
+	if err != nil {
+		entry.Level, entry.Message = "error", err.Error()
 	}
 
-	return t, nil
+	b, _ := json.Marshal(entry)
+	m.Logger.Writer().Write(append(b, '\n'))
 }
 
-// Config represnts the configuration file used to store command settings.
-type Config struct {
-	WorkDir string `toml:"work_dir"`
+// tickInterval returns the time to wait between ticks. If every command
+// specifies a minimum tick interval then the smallest one is used.
+func (m *Main) tickInterval() time.Duration {
+	if d := m.Ticker().MinTickInterval(); d > 0 {
+		return d
+	}
+	return m.TickInterval
+}
 
-	Wallpaper struct {
-		Enabled     bool     `toml:"enabled"`
-		Step        Duration `toml:"step"`
-		Interval    Duration `toml:"interval"`
-		Times       []string `toml:"times"`
-		Foregrounds []string `toml:"foregrounds"`
-		Backgrounds []string `toml:"backgrounds"`
-	} `toml:"wallpaper"`
+// Ticker returns the current ticker.
+func (m *Main) Ticker() *boxer.Ticker {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ticker
+}
 
-	MenuBar struct {
-		Enabled  bool     `toml:"enabled"`
-		Interval Duration `toml:"interval"`
-	} `toml:"menu_bar"`
+// RunValidate reads the configuration and reports any invalid fields.
+// Returns an error if any field is invalid.
+func (m *Main) RunValidate(args []string) error {
+	// Parse CLI arguments.
+	fs := flag.NewFlagSet("boxer-validate", flag.ContinueOnError)
+	configPath := fs.String("config", "", "config path")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
 
-	Announcement struct {
-		Enabled  bool     `toml:"enabled"`
-		Interval Duration `toml:"interval"`
-		Voice    string   `toml:"voice"`
-		Source   string   `toml:"source"`
-	} `toml:"announcement"`
+	// Read configuration file.
+	config, err := m.ReadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("read config: %s", err)
+	}
+
+	// Report the result of each check.
+	var invalid int
+	for _, chk := range config.Check() {
+		if chk.Err != nil {
+			fmt.Fprintf(m.Stdout, "FAIL %s: %s\n", chk.Field, chk.Err)
+			invalid++
+		} else {
+			fmt.Fprintf(m.Stdout, "ok   %s\n", chk.Field)
+		}
+	}
+
+	if invalid > 0 {
+		return fmt.Errorf("config has %d invalid field(s)", invalid)
+	}
+	return nil
 }
 
-// NewConfig returns an instance of Config with default settings.
-func NewConfig() *Config {
-	var c Config
+// RunBench measures how long it takes to generate a single wallpaper at the
+// current desktop size using the configured generator. The wallpaper is not set.
+func (m *Main) RunBench(args []string) error {
+	// Parse CLI arguments.
+	fs := flag.NewFlagSet("boxer-bench", flag.ContinueOnError)
+	configPath := fs.String("config", "", "config path")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
 
-	c.Wallpaper.Enabled = false
-	c.Wallpaper.Step = Duration{1 * time.Minute}
-	c.Wallpaper.Interval = Duration{15 * time.Minute}
+	// Read configuration file.
+	config, err := m.ReadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("read config: %s", err)
+	}
 
-	c.MenuBar.Enabled = false
-	c.MenuBar.Interval = Duration{15 * time.Minute}
+	// Create the generator and determine the current desktop size.
+	generator, err := NewWallpaperGenerator(config, boxer.NewTicker())
+	if err != nil {
+		return err
+	}
+	w, h, err := NewDesktopSizer(config, m.DesktopSizer)(m.Executor)
+	if err != nil {
+		return fmt.Errorf("desktop size: %s", err)
+	}
 
-	c.Announcement.Enabled = false
-	c.Announcement.Interval = Duration{30 * time.Minute}
+	// Generate a wallpaper into a temporary directory.
+	dir, err := ioutil.TempDir("", "boxer-bench-")
+	if err != nil {
+		return fmt.Errorf("temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
 
-	return &c
-}
+	start := time.Now()
+	if err := generator(filepath.Join(dir, "wallpaper"+wallpaperExt(config)), w, h, 0.5); err != nil {
+		return fmt.Errorf("generate wallpaper: %s", err)
+	}
+	d := time.Since(start)
 
-// Duration is used by the TOML config to parse duration values.
-type Duration struct {
-	time.Duration
+	fmt.Fprintf(m.Stdout, "generated %dx%d wallpaper in %s\n", w, h, d)
+	return nil
 }
 
-func (d *Duration) UnmarshalText(text []byte) error {
-	v, err := time.ParseDuration(string(text))
+// RunSimulate runs the configured commands against a fast fake clock and
+// reports every step instead of invoking the real handlers. This shows what a
+// config does over a long period of time in a few seconds.
+func (m *Main) RunSimulate(args []string) error {
+	// Parse CLI arguments.
+	fs := flag.NewFlagSet("boxer-simulate", flag.ContinueOnError)
+	configPath := fs.String("config", "", "config path")
+	speed := fs.Float64("speed", 3600, "simulated seconds per real second, zero runs as fast as possible")
+	duration := fs.Duration("duration", 8*time.Hour, "simulated duration")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// Read configuration file & create a ticker that only logs commands.
+	// No helper processes are started and no directories are created.
+	config, err := m.ReadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("read config: %s", err)
+	}
+	logger := log.New(m.Stdout, "", 0)
+	ticker, err := newTicker(config, boxer.NewDryRunCommandExecutor(logger), m.Clock, logger, true)
 	if err != nil {
 		return err
 	}
+	defer ticker.Close()
+
+	// Replace each handler so that steps are reported instead of executed.
+	var now time.Time
+	for j := range ticker.Commands {
+		name := ticker.Commands[j].Name
+		ticker.Commands[j].Restorable = nil
+		ticker.Commands[j].Handler = func(i, n int) error {
+			if i == 0 {
+				fmt.Fprintf(m.Stdout, "%s %s: interval started\n", now.Format("15:04:05"), name)
+			}
+			fmt.Fprintf(m.Stdout, "%s %s: step %d/%d\n", now.Format("15:04:05"), name, i+1, n)
+			return nil
+		}
+	}
+
+	// Determine the simulated time between ticks.
+	interval := ticker.MinTickInterval()
+	if interval == 0 {
+		interval = m.TickInterval
+	}
+
+	// Advance the fake clock one tick at a time, waiting between ticks if a
+	// speed is specified.
+	start := m.Clock.Now()
+	for now = start; now.Sub(start) < *duration; now = now.Add(interval) {
+		ticker.TickAt(now)
+
+		if *speed > 0 {
+			<-m.Clock.After(time.Duration(float64(interval) / *speed))
+		}
+	}
 
-	d.Duration = v
 	return nil
 }
 
+// ReadConfig reads the configuration from a path.
+// If no path is provided then the default path is used.
+func (m *Main) ReadConfig(path string) (*Config, error) {
+	// If no path is provided then use the default path.
+	if path == "" {
+		str, err := DefaultConfigPath()
+		if err != nil {
+			return nil, fmt.Errorf("default config path: %s", err)
+		}
+		path = str
+	}
+
+	// Decode file into config. A path of "-" reads the config from stdin.
+	// Stdin is only read once so that reloads reuse the same config.
+	config := NewConfig()
+	if path == "-" {
+		if m.stdin == nil {
+			b, err := ioutil.ReadAll(m.Stdin)
+			if err != nil {
+				return nil, fmt.Errorf("read stdin: %s", err)
+			}
+			m.stdin = b
+		}
+		if _, err := toml.DecodeReader(bytes.NewReader(m.stdin), &config); err != nil {
+			return nil, err
+		}
+	} else if _, err := toml.DecodeFile(path, &config); err != nil {
+		return nil, err
+	}
+
+	// Expand the wallpaper theme into its settings.
+	if err := config.ApplyTheme(); err != nil {
+		return nil, err
+	}
+
+	// Expand home directory & environment variables in paths.
+	if err := config.ExpandPaths(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// PrintConfig writes the effective configuration at path to stdout as TOML.
+// Defaults, themes, expanded paths & flags are all reflected in the output.
+func (m *Main) PrintConfig(path string) error {
+	config, err := m.ReadConfig(path)
+	if err != nil {
+		return fmt.Errorf("read config: %s", err)
+	}
+
+	// Apply the same overrides & defaults as Reload. The work directory is
+	// left blank when a temp directory would be used.
+	if m.WorkDir != "" {
+		config.WorkDir = m.WorkDir
+	}
+	if config.TickInterval.Duration == 0 {
+		config.TickInterval.Duration = m.TickInterval
+	}
+	if config.SleepThreshold.Duration == 0 {
+		// Build a ticker without side effects to find the time between ticks.
+		logger := log.New(ioutil.Discard, "", 0)
+		ticker, err := newTicker(config, boxer.NewDryRunCommandExecutor(logger), m.Clock, logger, true)
+		if err != nil {
+			return fmt.Errorf("cannot create ticker: %s", err)
+		}
+		defer ticker.Close()
+		config.SleepThreshold.Duration = defaultSleepThreshold(ticker, config.TickInterval.Duration)
+	}
+
+	return toml.NewEncoder(m.Stdout).Encode(config)
+}
+
+// defaultSleepThreshold returns the sleep threshold used when none is
+// configured. It is the actual time between ticks plus a margin.
+func defaultSleepThreshold(t *boxer.Ticker, tickInterval time.Duration) time.Duration {
+	if d := t.MinTickInterval(); d > 0 {
+		tickInterval = d
+	}
+	return tickInterval + DefaultSleepMargin
+}
+
+// ExpandPaths expands a leading "~" and any environment variables in the
+// path settings of the config.
+func (c *Config) ExpandPaths() error {
+	for _, p := range []*string{
+		&c.WorkDir,
+		&c.Wallpaper.WorkDir,
+		&c.Wallpaper.Path,
+		&c.Wallpaper.VolatilePath,
+		&c.Wallpaper.StatusIconPath,
+		&c.Wallpaper.ImagePath,
+		&c.Wallpaper.WatermarkPath,
+		&c.Overlay.Helper,
+		&c.Socket.Path,
+		&c.TaskFile.Path,
+		&c.StatusText.Path,
+	} {
+		v, err := ExpandPath(*p)
+		if err != nil {
+			return err
+		}
+		*p = v
+	}
+	return nil
+}
+
+// ExpandPath expands a leading "~" to the user's home directory and replaces
+// "$VAR" & "${VAR}" with the value of the environment variable.
+func ExpandPath(path string) (string, error) {
+	path = os.ExpandEnv(path)
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("expand path: %s", err)
+	}
+	return filepath.Join(home, path[1:]), nil
+}
+
+// DefaultConfigPath returns the default configuration path.
+//
+// The BOXER_CONFIG environment variable is used if set. Otherwise the first
+// existing path of "$XDG_CONFIG_HOME/boxer/boxer.conf" (which defaults to
+// "~/.config") and the legacy "~/boxer.conf" is returned. If neither exists
+// then the XDG path is returned.
+func DefaultConfigPath() (string, error) {
+	if path := os.Getenv("BOXER_CONFIG"); path != "" {
+		return path, nil
+	}
+
+	u, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+
+	// Determine the XDG config directory.
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		configHome = filepath.Join(u.HomeDir, ".config")
+	}
+	xdgPath := filepath.Join(configHome, "boxer", "boxer.conf")
+
+	// Return the first path that exists.
+	for _, path := range []string{xdgPath, filepath.Join(u.HomeDir, "boxer.conf")} {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return xdgPath, nil
+}
+
+// NewTicker creates a new ticker from configuration.
+func NewTicker(c *Config, exec boxer.CommandExecutor) (*boxer.Ticker, error) {
+	return newTicker(c, exec, boxer.DefaultClock, log.New(os.Stderr, "", 0), false)
+}
+
+// newTicker creates a new ticker from configuration. The ticker and any
+// handlers that depend on the time of day use clock for the current time.
+// Handler results and warnings are written to logger.
+// If dryRun is true then setup with side effects, such as starting helper
+// processes or creating the work directory, is skipped.
+func newTicker(c *Config, exec boxer.CommandExecutor, clock boxer.Clock, logger *log.Logger, dryRun bool) (*boxer.Ticker, error) {
+	// Fail at startup instead of on every tick if the work directory can't be
+	// written to. This is checked before any handler is built.
+	if c.WorkDir != "" && !dryRun {
+		if err := checkWritable(c.WorkDir); err != nil {
+			return nil, fmt.Errorf("work dir not writable: %s", err)
+		}
+	}
+
+	t := boxer.NewTicker()
+	t.Now = clock.Now
+	t.Logger = logger
+	t.Concurrent = c.Concurrent
+
+	// Align steps & intervals to the anchor time of day, if specified.
+	if c.AnchorTime != "" {
+		v, err := time.Parse("3:04pm", c.AnchorTime)
+		if err != nil {
+			return nil, fmt.Errorf("parse anchor time: %s", err)
+		}
+		now := clock.Now()
+		t.Anchor = time.Date(now.Year(), now.Month(), now.Day(), v.Hour(), v.Minute(), 0, 0, time.Local)
+	}
+
+	// Round the remaining time shown by text handlers down by default.
+	rounding := boxer.RoundFloor
+	if c.Rounding != "" {
+		r, err := boxer.ParseRounding(c.Rounding)
+		if err != nil {
+			return nil, fmt.Errorf("parse rounding: %s", err)
+		}
+		rounding = r
+	}
+
+	// Only execute handlers during the scheduled hours & days, if specified.
+	if c.Schedule.Start != "" || c.Schedule.End != "" || len(c.Schedule.Days) > 0 {
+		schedule := &boxer.Schedule{}
+		if c.Schedule.Start != "" || c.Schedule.End != "" {
+			v, err := boxer.ActiveBetween(c.Schedule.Start, c.Schedule.End)
+			if err != nil {
+				return nil, fmt.Errorf("schedule: %s", err)
+			}
+			schedule = v
+		}
+
+		days, err := boxer.ParseWeekdays(c.Schedule.Days)
+		if err != nil {
+			return nil, fmt.Errorf("schedule: %s", err)
+		}
+		schedule.Days = days
+
+		t.Schedule = schedule
+	}
+
+	var wallpaperDir string
+	if c.Wallpaper.Enabled {
+		// Create a wallpaper generator.
+		generator, err := NewWallpaperGenerator(c, t)
+		if err != nil {
+			return nil, err
+		}
+
+		// Create a second generator with the dark backgrounds, if specified.
+		var darkGenerator boxer.WallpaperGenerator
+		if len(c.Wallpaper.DarkBackgrounds) > 0 {
+			dc := *c
+			dc.Wallpaper.Backgrounds = c.Wallpaper.DarkBackgrounds
+			if darkGenerator, err = NewWallpaperGenerator(&dc, t); err != nil {
+				return nil, fmt.Errorf("dark backgrounds: %s", err)
+			}
+		}
+
+		// Use the command's work directory, if specified.
+		workDir := c.WorkDir
+		if c.Wallpaper.WorkDir != "" {
+			workDir = c.Wallpaper.WorkDir
+		}
+
+		// Store generated wallpapers in the configured directory. Relative
+		// paths are within the work directory.
+		dir := filepath.Join(workDir, "wallpaper")
+		if p := c.Wallpaper.Path; filepath.IsAbs(p) {
+			dir = p
+		} else if p != "" {
+			dir = filepath.Join(workDir, p)
+		}
+
+		// Regenerate wallpapers in a volatile directory instead of caching
+		// them in the work directory, if requested. This defaults to the
+		// per-user temp directory.
+		if c.Wallpaper.Volatile {
+			dir = c.Wallpaper.VolatilePath
+			if dir == "" {
+				dir = filepath.Join(os.TempDir(), "boxer-wallpaper")
+			}
+		}
+		wallpaperDir = dir
+
+		// Determine the wallpaper size from the primary display.
+		sizer := NewDesktopSizer(c, boxer.PrimaryDesktopSize)
+
+		setter, err := wallpaperSetter(c)
+		if err != nil {
+			return nil, err
+		}
+
+		// Generate a new command. The user's wallpaper is restored on shutdown.
+		h := &boxer.WallpaperHandler{
+			Exec:          exec,
+			Sizer:         sizer,
+			Generator:     generator,
+			DarkGenerator: darkGenerator,
+			Path:          dir,
+			Key:           wallpaperKey(c),
+			Ext:           wallpaperExt(c),
+
+			// The tomato & cycle styles change between intervals so they
+			// are never cached. Volatile wallpapers are never cached either.
+			DisableCache: !c.Wallpaper.Cache || c.Wallpaper.Volatile || c.Wallpaper.Style == "tomato" || c.Wallpaper.Style == "cycle",
+
+			Setter:             setter,
+			TransitionFrames:   c.Wallpaper.TransitionFrames,
+			TransitionDuration: c.Wallpaper.TransitionDuration.Duration,
+		}
+		if c.Wallpaper.LockScreen {
+			h.LockScreen = boxer.NewLockScreen(logger)
+		}
+		t.Commands = append(t.Commands, boxer.Command{
+			Name:            "wallpaper",
+			Step:            c.Wallpaper.Step.Duration,
+			Interval:        c.Wallpaper.Interval.Duration,
+			MinTickInterval: c.Wallpaper.MinTickInterval.Duration,
+			Handler:         h.Handle,
+			Restorable:      h,
+		})
+
+		// Remove old cached wallpapers every interval, if requested.
+		if c.Wallpaper.MaxCachedWallpapers > 0 {
+			keep := c.Wallpaper.MaxCachedWallpapers
+			t.Commands = append(t.Commands, boxer.Command{
+				Name:     "prune_wallpapers",
+				Interval: c.Wallpaper.Interval.Duration,
+				Handler:  func(i, n int) error { return boxer.PruneWallpapers(dir, keep) },
+			})
+		}
+
+		// Archive the completed wallpaper of each interval, if requested.
+		if c.Wallpaper.Archive {
+			t.Commands = append(t.Commands, boxer.Command{
+				Name:     "archive",
+				Step:     c.Wallpaper.Step.Duration,
+				Interval: c.Wallpaper.Interval.Duration,
+				Handler: boxer.NewArchiveHandler(
+					exec, sizer, generator, clock.Now,
+					filepath.Join(workDir, "archive"),
+				),
+			})
+		}
+
+		// Also generate a small status icon, if requested.
+		if c.Wallpaper.StatusIconPath != "" {
+			t.Commands = append(t.Commands, boxer.Command{
+				Name:     "status_icon",
+				Step:     c.Wallpaper.Step.Duration,
+				Interval: c.Wallpaper.Interval.Duration,
+				Handler:  boxer.NewStatusIconHandler(generator, c.Wallpaper.StatusIconPath),
+			})
+		}
+	}
+
+	if c.Announcement.Enabled {
+		if c.Announcement.TimeFormat != "" {
+			if chk := checkTimeFormat("announcement.time_format", c.Announcement.TimeFormat); chk.Err != nil {
+				return nil, fmt.Errorf("%s: %s", chk.Field, chk.Err)
+			}
+		}
+		t.Commands = append(t.Commands, boxer.Command{
+			Name:     "announcement",
+			Interval: c.Announcement.Interval.Duration,
+			Handler: boxer.NewAnnouncementHandlerWithOptions(exec, boxer.AnnouncementOptions{
+				Subtitle:   c.Announcement.Subtitle,
+				Sound:      c.Announcement.Sound,
+				TimeFormat: c.Announcement.TimeFormat,
+			}),
+		})
+	}
+
+	if c.Speech.Enabled {
+		t.Commands = append(t.Commands, boxer.Command{
+			Name:     "speech",
+			Interval: c.Speech.Interval.Duration,
+			Handler:  boxer.NewSpeechHandler(exec, c.Speech.Text, c.Speech.Voice),
+		})
+	}
+
+	if c.Countdown.Enabled {
+		at := make([]time.Duration, len(c.Countdown.At))
+		for i, d := range c.Countdown.At {
+			at[i] = d.Duration
+		}
+
+		t.Commands = append(t.Commands, boxer.Command{
+			Name:     "countdown",
+			Step:     c.Countdown.Step.Duration,
+			Interval: c.Countdown.Interval.Duration,
+			Handler:  boxer.NewCountdownHandler(exec, c.Countdown.Step.Duration, at),
+		})
+	}
+
+	if c.MenuBar.Enabled {
+		// Urgent flashing depends on the step's progress so it has no effect
+		// when flashing once per interval.
+		if c.MenuBar.Urgent && c.MenuBar.Step.Duration == 0 {
+			return nil, fmt.Errorf("menu bar: urgent requires a step")
+		}
+
+		handler := boxer.NewMenuBarHandler(exec)
+		if c.MenuBar.FlashOnly {
+			handler = boxer.NewMenuBarFlashHandler(exec)
+		} else if c.MenuBar.Urgent {
+			handler = boxer.NewMenuBarHandlerWithFlash(exec, boxer.UrgentMenuBarFlash)
+		}
+
+		t.Commands = append(t.Commands, boxer.Command{
+			Name:     "menu_bar",
+			Step:     c.MenuBar.Step.Duration,
+			Interval: c.MenuBar.Interval.Duration,
+			Handler:  handler,
+		})
+	}
+
+	if c.NightShift.Enabled {
+		schedule, err := boxer.ActiveBetween(c.NightShift.After, c.NightShift.Until)
+		if err != nil {
+			return nil, fmt.Errorf("night shift schedule: %s", err)
+		}
+
+		t.Commands = append(t.Commands, boxer.Command{
+			Name:     "night_shift",
+			Step:     c.NightShift.Step.Duration,
+			Interval: c.NightShift.Interval.Duration,
+			Handler:  boxer.NewNightShiftHandler(exec, clock.Now, schedule),
+		})
+	}
+
+	if c.AccentColor.Enabled {
+		var colors []color.RGBA
+		for _, s := range c.AccentColor.Colors {
+			c, err := boxer.ParseColor(s)
+			if err != nil {
+				return nil, fmt.Errorf("parse accent color: %s", err)
+			}
+			colors = append(colors, c)
+		}
+
+		t.Commands = append(t.Commands, boxer.Command{
+			Name:     "accent_color",
+			Step:     c.AccentColor.Step.Duration,
+			Interval: c.AccentColor.Interval.Duration,
+			Handler:  boxer.NewAccentColorHandler(exec, colors),
+		})
+	}
+
+	if c.TouchBar.Enabled {
+		t.Commands = append(t.Commands, boxer.Command{
+			Name:     "touch_bar",
+			Step:     c.TouchBar.Step.Duration,
+			Interval: c.TouchBar.Interval.Duration,
+			Handler:  boxer.NewTouchBarHandler(exec),
+		})
+	}
+
+	if c.DesktopIcons.Enabled {
+		// Icons are shown again on shutdown if they are hidden.
+		h := &boxer.DesktopIconsHandler{Exec: exec}
+		t.Commands = append(t.Commands, boxer.Command{
+			Name:       "desktop_icons",
+			Step:       c.DesktopIcons.Step.Duration,
+			Interval:   c.DesktopIcons.Interval.Duration,
+			Handler:    h.Handle,
+			Restorable: h,
+		})
+	}
+
+	if c.MenuBarAutohide.Enabled {
+		// The menu bar is shown again on shutdown if it is hidden.
+		h := &boxer.MenuBarAutohideHandler{Exec: exec}
+		t.Commands = append(t.Commands, boxer.Command{
+			Name:       "menu_bar_autohide",
+			Step:       c.MenuBarAutohide.Step.Duration,
+			Interval:   c.MenuBarAutohide.Interval.Duration,
+			Handler:    h.Handle,
+			Restorable: h,
+		})
+	}
+
+	if c.Overlay.Enabled {
+		cmd := boxer.Command{
+			Name:     "overlay",
+			Step:     c.Overlay.Step.Duration,
+			Interval: c.Overlay.Interval.Duration,
+			Handler:  boxer.NewOverlayHandler(ioutil.Discard),
+		}
+		if !dryRun {
+			w, err := boxer.StartOverlayHelper(c.Overlay.Helper)
+			if err != nil {
+				return nil, fmt.Errorf("start overlay helper: %s", err)
+			}
+			cmd.Handler, cmd.Closer = boxer.NewOverlayHandler(w), w
+		}
+		t.Commands = append(t.Commands, cmd)
+	}
+
+	if c.Socket.Enabled {
+		if c.Socket.Path == "" {
+			return nil, fmt.Errorf("socket: path required")
+		}
+		h := &boxer.SocketHandler{Path: c.Socket.Path}
+		t.Commands = append(t.Commands, boxer.Command{
+			Name:     "socket",
+			Step:     c.Socket.Step.Duration,
+			Interval: c.Socket.Interval.Duration,
+			Handler:  h.Handle,
+			Closer:   h,
+		})
+	}
+
+	if c.TaskFile.Enabled {
+		labels := c.TaskFile.Labels
+		if len(labels) == 0 {
+			return nil, fmt.Errorf("task file: at least one label required")
+		}
+
+		t.Commands = append(t.Commands, boxer.Command{
+			Name:     "task_file",
+			Step:     c.TaskFile.Step.Duration,
+			Interval: c.TaskFile.Interval.Duration,
+			Handler: boxer.NewTaskFileHandler(c.TaskFile.Path, func(index int) string {
+				return labels[index%len(labels)]
+			}),
+		})
+	}
+
+	if c.StatusText.Enabled {
+		if c.StatusText.Path == "" {
+			return nil, fmt.Errorf("status text: path required")
+		}
+		t.Commands = append(t.Commands, boxer.Command{
+			Name:     "status_text",
+			Step:     c.StatusText.Step.Duration,
+			Interval: c.StatusText.Interval.Duration,
+			Handler: boxer.NewStatusTextHandler(c.StatusText.Path, c.StatusText.Step.Duration, boxer.TextOptions{
+				Rounding:    rounding,
+				MinFontSize: c.StatusText.MinFontSize,
+				MaxFontSize: c.StatusText.MaxFontSize,
+			}),
+		})
+	}
+
+	if c.ITermBadge.Enabled {
+		t.Commands = append(t.Commands, boxer.Command{
+			Name:     "iterm_badge",
+			Step:     c.ITermBadge.Step.Duration,
+			Interval: c.ITermBadge.Interval.Duration,
+			Handler:  boxer.NewITermBadgeHandler(os.Stdout, c.ITermBadge.Step.Duration, boxer.TextOptions{Rounding: rounding}),
+		})
+	}
+
+	if c.Console.Enabled {
+		t.Commands = append(t.Commands, boxer.Command{
+			Name:     "console",
+			Step:     c.Console.Step.Duration,
+			Interval: c.Console.Interval.Duration,
+			Handler:  boxer.NewConsoleHandler(os.Stdout, c.Console.Step.Duration, boxer.TextOptions{Rounding: rounding}),
+		})
+	}
+
+	// Add user-defined commands.
+	for i, cc := range c.Commands {
+		name := cc.Name
+		if name == "" {
+			name = fmt.Sprintf("command[%d]", i)
+		}
+
+		switch cc.Type {
+		case "exec":
+			if cc.Path == "" {
+				return nil, fmt.Errorf("%s: path required", name)
+			}
+			if err := t.AddCommand(boxer.Command{
+				Name:     name,
+				Step:     cc.Step.Duration,
+				Interval: cc.Interval.Duration,
+				Handler:  boxer.NewExecHandler(exec, cc.Path, cc.Args),
+			}); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%s: unknown command type: %q", name, cc.Type)
+		}
+	}
+
+	// Ensure each command has a valid step & interval.
+	for _, cmd := range t.Commands {
+		if err := cmd.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %s", cmd.Name, err)
+		}
+	}
+
+	// Pause visual & notification commands while the user is away, if
+	// requested. The idle time is queried at most once per tick.
+	if c.IdleThreshold.Duration > 0 {
+		idle := boxer.NewIdleChecker(exec, c.IdleThreshold.Duration)
+		t.OnTick = func(time.Time) { idle.Reset() }
+		for i := range t.Commands {
+			if idleGatedCommands[t.Commands[i].Name] {
+				t.Commands[i].Handler = idle.Gate(t.Commands[i].Handler)
+			}
+		}
+	}
+
+	// Wallpapers may be stored outside of the work directory so check their
+	// directory separately.
+	if wallpaperDir != "" && !dryRun {
+		if err := checkWritable(wallpaperDir); err != nil {
+			return nil, fmt.Errorf("wallpaper dir not writable: %s", err)
+		}
+	}
+
+	return t, nil
+}
+
+// idleGatedCommands are the names of the visual & notification commands that
+// are paused while the user is away. Other commands, such as pruning or
+// writing status files, continue to run.
+var idleGatedCommands = map[string]bool{
+	"wallpaper":    true,
+	"announcement": true,
+	"speech":       true,
+	"countdown":    true,
+	"menu_bar":     true,
+	"night_shift":  true,
+	"accent_color": true,
+	"touch_bar":    true,
+	"overlay":      true,
+	"iterm_badge":  true,
+	"console":      true,
+}
+
+// NewWallpaperGenerator creates a wallpaper generator from configuration.
+// The ticker's wallpaper interval counts are used by the "tomato" and "cycle"
+// styles. The fill is eased using the configured easing, if any.
+func NewWallpaperGenerator(c *Config, t *boxer.Ticker) (boxer.WallpaperGenerator, error) {
+	ease, err := boxer.ParseEasing(c.Wallpaper.Easing)
+	if err != nil {
+		return nil, fmt.Errorf("wallpaper generator: %s", err)
+	}
+
+	generator, err := newWallpaperGenerator(c, t)
+	if err != nil {
+		return nil, err
+	}
+	return boxer.NewEasedWallpaperGenerator(generator, ease), nil
+}
+
+// newWallpaperGenerator creates a wallpaper generator for the configured style.
+func newWallpaperGenerator(c *Config, t *boxer.Ticker) (boxer.WallpaperGenerator, error) {
+	// Parse times from config.
+	var times []time.Time
+	for _, s := range c.Wallpaper.Times {
+		t, err := time.Parse("3:04pm", s)
+		if err != nil {
+			return nil, fmt.Errorf("parse wallpaper time: %s", err)
+		}
+		times = append(times, t)
+	}
+
+	// Parse backgroun color from config.
+	var backgrounds []color.RGBA
+	for _, s := range c.Wallpaper.Backgrounds {
+		c, err := boxer.ParseColor(s)
+		if err != nil {
+			return nil, fmt.Errorf("parse wallpaper background: %s", err)
+		}
+		backgrounds = append(backgrounds, c)
+	}
+
+	// Parse foreground color from config. An "auto" foreground contrasts
+	// with the background at the same position, or the last background.
+	var foregrounds []color.RGBA
+	for i, s := range c.Wallpaper.Foregrounds {
+		if strings.EqualFold(s, boxer.AutoColor) {
+			if len(backgrounds) == 0 {
+				return nil, fmt.Errorf("parse wallpaper foreground: auto requires a background color")
+			}
+			bg := backgrounds[len(backgrounds)-1]
+			if i < len(backgrounds) {
+				bg = backgrounds[i]
+			}
+			foregrounds = append(foregrounds, boxer.ContrastColor(bg))
+			continue
+		}
+
+		c, err := boxer.ParseColor(s)
+		if err != nil {
+			return nil, fmt.Errorf("parse wallpaper foreground: %s", err)
+		}
+		foregrounds = append(foregrounds, c)
+	}
+
+	// Parse the edge the foreground fills from.
+	var opt boxer.WallpaperOptions
+	dir, err := boxer.ParseFillDirection(c.Wallpaper.Direction)
+	if err != nil {
+		return nil, fmt.Errorf("wallpaper generator: %s", err)
+	}
+	opt.Direction = dir
+
+	// Validate the image format & quality.
+	switch c.Wallpaper.Format {
+	case "", "png", "jpeg":
+	default:
+		return nil, fmt.Errorf("invalid wallpaper format: %q", c.Wallpaper.Format)
+	}
+	if c.Wallpaper.Quality < 0 || c.Wallpaper.Quality > 100 {
+		return nil, fmt.Errorf("invalid wallpaper quality: %d", c.Wallpaper.Quality)
+	}
+	opt.Quality = c.Wallpaper.Quality
+
+	// Parse the divider color, if specified.
+	if c.Wallpaper.DividerColor != "" {
+		divider, err := boxer.ParseColor(c.Wallpaper.DividerColor)
+		if err != nil {
+			return nil, fmt.Errorf("parse wallpaper divider_color: %s", err)
+		}
+		opt.DividerColor, opt.DividerWidth = divider, c.Wallpaper.DividerWidth
+	}
+
+	// Load the watermark once so a bad file is reported up front.
+	if c.Wallpaper.WatermarkPath != "" {
+		if opt.Watermark, err = boxer.LoadImage(c.Wallpaper.WatermarkPath); err != nil {
+			return nil, fmt.Errorf("wallpaper watermark: %s", err)
+		} else if opt.WatermarkPosition, err = boxer.ParseWatermarkPosition(c.Wallpaper.WatermarkPosition); err != nil {
+			return nil, fmt.Errorf("wallpaper watermark: %s", err)
+		}
+	}
+
+	// Create a wallpaper generator for the style.
+	switch c.Wallpaper.Style {
+	case "", "solid":
+		generator, err := boxer.NewWallpaperGeneratorWithOptions(time.Now, times, foregrounds, backgrounds, opt)
+		if err != nil {
+			return nil, fmt.Errorf("wallpaper generator: %s", err)
+		}
+		return generator, nil
+
+	case "horizontal":
+		// Fill from the left edge unless the right edge is requested, either
+		// directly or as the default for right-to-left layouts.
+		if opt.Direction != boxer.FillLeft && opt.Direction != boxer.FillRight {
+			opt.Direction = boxer.FillLeft
+			if c.Wallpaper.RTL {
+				opt.Direction = boxer.FillRight
+			}
+		}
+		generator, err := boxer.NewWallpaperGeneratorWithOptions(time.Now, times, foregrounds, backgrounds, opt)
+		if err != nil {
+			return nil, fmt.Errorf("wallpaper generator: %s", err)
+		}
+		return generator, nil
+
+	case "palette":
+		if len(backgrounds) != 1 {
+			return nil, fmt.Errorf("wallpaper generator: palette style requires one background color")
+		}
+		return boxer.NewPaletteLerpWallpaperGenerator(backgrounds[0], foregrounds, opt), nil
+
+	case "radial":
+		if len(foregrounds) == 0 || len(backgrounds) == 0 {
+			return nil, fmt.Errorf("wallpaper generator: radial style requires foreground & background colors")
+		}
+		return boxer.NewRadialWallpaperGenerator(foregrounds[0], backgrounds[0], opt), nil
+
+	case "gradient":
+		if len(foregrounds) == 0 {
+			return nil, fmt.Errorf("wallpaper generator: gradient style requires a foreground color")
+		}
+		from, err := boxer.ParseColor(c.Wallpaper.GradientFrom)
+		if err != nil {
+			return nil, fmt.Errorf("parse wallpaper gradient_from: %s", err)
+		}
+		to, err := boxer.ParseColor(c.Wallpaper.GradientTo)
+		if err != nil {
+			return nil, fmt.Errorf("parse wallpaper gradient_to: %s", err)
+		}
+		return boxer.NewGradientWallpaperGenerator(foregrounds[0], from, to, opt), nil
+
+	case "tomato":
+		if len(foregrounds) == 0 || len(backgrounds) == 0 {
+			return nil, fmt.Errorf("wallpaper generator: tomato style requires foreground & background colors")
+		} else if c.Wallpaper.TomatoCount <= 0 {
+			return nil, fmt.Errorf("wallpaper generator: tomato_count must be positive: %d", c.Wallpaper.TomatoCount)
+		}
+		completed := func() int { return t.CompletedIntervals("wallpaper") }
+		return boxer.NewTomatoCountGenerator(completed, c.Wallpaper.TomatoCount, foregrounds[0], backgrounds[0], opt), nil
+
+	case "cycle":
+		if len(foregrounds) == 0 || len(backgrounds) == 0 {
+			return nil, fmt.Errorf("wallpaper generator: cycle style requires foreground & background colors")
+		}
+		index := func() int { return t.IntervalIndex("wallpaper") }
+		return boxer.NewCyclingWallpaperGenerator(index, foregrounds, backgrounds[0], opt), nil
+
+	case "image":
+		if len(foregrounds) == 0 {
+			return nil, fmt.Errorf("wallpaper generator: image style requires a foreground color")
+		} else if c.Wallpaper.ImagePath == "" {
+			return nil, fmt.Errorf("wallpaper generator: image style requires image_path")
+		}
+		m, err := boxer.LoadImage(c.Wallpaper.ImagePath)
+		if err != nil {
+			return nil, fmt.Errorf("wallpaper image: %s", err)
+		}
+		return boxer.NewImageWallpaperGenerator(foregrounds[0], m, opt), nil
+
+	default:
+		return nil, fmt.Errorf("unknown wallpaper style: %q", c.Wallpaper.Style)
+	}
+}
+
+// Theme represents a named set of wallpaper settings.
+type Theme struct {
+	Style       string
+	Foregrounds []string
+	Backgrounds []string
+	Easing      string
+}
+
+// Themes are the built-in themes that can be selected by name in the config.
+var Themes = map[string]Theme{
+	// Blend from the dark blue of night to a bright yellow sun.
+	"sunrise": {
+		Style:       "palette",
+		Foregrounds: []string{"#1B2A49", "#E0704C", "#F9D56E"},
+		Backgrounds: []string{"#0B1426"},
+		Easing:      "ease_in_out",
+	},
+
+	// A solid bar that gradually fades as the day goes on.
+	"drain": {
+		Style:       "solid",
+		Foregrounds: []string{"#3A7CA5", "#81C3D7"},
+		Backgrounds: []string{"#16425B"},
+		Easing:      "linear",
+	},
+
+	// A ring that spreads quickly from the center and slows near the corners.
+	"rings": {
+		Style:       "radial",
+		Foregrounds: []string{"#F25F5C"},
+		Backgrounds: []string{"#247BA0"},
+		Easing:      "ease_out",
+	},
+}
+
+// ApplyTheme replaces the wallpaper style, colors & easing with the settings
+// from the theme, if one is specified.
+func (c *Config) ApplyTheme() error {
+	if c.Wallpaper.Theme == "" {
+		return nil
+	}
+
+	theme, ok := Themes[c.Wallpaper.Theme]
+	if !ok {
+		return fmt.Errorf("unknown theme: %q", c.Wallpaper.Theme)
+	}
+	c.Wallpaper.Style = theme.Style
+	c.Wallpaper.Foregrounds = theme.Foregrounds
+	c.Wallpaper.Backgrounds = theme.Backgrounds
+	c.Wallpaper.Easing = theme.Easing
+	return nil
+}
+
+// checkWritable creates dir, if needed, and verifies a file can be written to it.
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(dir, ".boxer-probe")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// NewDesktopSizer wraps sizer to convert the desktop size from points to
+// pixels, if the configuration requests it. If a fixed width & height are
+// configured then sizer is not used.
+func NewDesktopSizer(c *Config, sizer boxer.DesktopSizer) boxer.DesktopSizer {
+	if c.Wallpaper.Width > 0 && c.Wallpaper.Height > 0 {
+		return boxer.FixedDesktopSize(c.Wallpaper.Width, c.Wallpaper.Height)
+	} else if c.Wallpaper.AutoScale {
+		return boxer.AutoScaleDesktopSizer(sizer)
+	} else if c.Wallpaper.Scale > 0 {
+		return boxer.ScaleDesktopSizer(sizer, c.Wallpaper.Scale)
+	}
+	return sizer
+}
+
+// wallpaperKey returns a hash of the settings used to generate wallpapers.
+// Changing any of these settings will invalidate previously cached wallpapers.
+func wallpaperKey(c *Config) string {
+	h := fnv.New32a()
+	fmt.Fprint(h, c.Wallpaper.Style, c.Wallpaper.Easing, c.Wallpaper.Direction, c.Wallpaper.RTL, c.Wallpaper.DividerColor, c.Wallpaper.DividerWidth, c.Wallpaper.GradientFrom, c.Wallpaper.GradientTo, c.Wallpaper.ImagePath, c.Wallpaper.WatermarkPath, c.Wallpaper.WatermarkPosition, c.Wallpaper.Quality, c.Wallpaper.Times, c.Wallpaper.Foregrounds, c.Wallpaper.Backgrounds, c.Wallpaper.DarkBackgrounds)
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// wallpaperSetter returns the setter used to apply wallpapers.
+func wallpaperSetter(c *Config) (boxer.WallpaperSetter, error) {
+	switch c.Wallpaper.Setter {
+	case "", "finder":
+		return withRetry(boxer.DefaultWallpaperSetter), nil
+	case "system_events":
+		return withRetry(boxer.SystemEventsWallpaperSetter), nil
+	default:
+		return nil, fmt.Errorf("invalid wallpaper setter: %q", c.Wallpaper.Setter)
+	}
+}
+
+// withRetry returns a setter that retries setter's osascript calls since they
+// occasionally fail transiently. Setting the wallpaper is idempotent so it is
+// safe to re-run, unlike other commands.
+func withRetry(setter boxer.WallpaperSetter) boxer.WallpaperSetter {
+	return func(exec boxer.CommandExecutor, path string) error {
+		return setter(boxer.WithRetry(exec, DefaultRetryAttempts, DefaultRetryBackoff), path)
+	}
+}
+
+// wallpaperExt returns the file extension for the configured wallpaper format.
+func wallpaperExt(c *Config) string {
+	if c.Wallpaper.Format == "jpeg" {
+		return ".jpg"
+	}
+	return ".png"
+}
+
+// Config represnts the configuration file used to store command settings.
+type Config struct {
+	WorkDir    string `toml:"work_dir"`
+	AnchorTime string `toml:"anchor_time"`
+	Concurrent bool   `toml:"concurrent"`
+	Rounding   string `toml:"rounding"`
+
+	TickInterval   Duration `toml:"tick_interval"`
+	SleepThreshold Duration `toml:"sleep_threshold"`
+	IdleThreshold  Duration `toml:"idle_threshold"`
+
+	ShutdownCommand string   `toml:"shutdown_command"`
+	ShutdownArgs    []string `toml:"shutdown_args"`
+
+	Schedule struct {
+		Start string   `toml:"start"`
+		End   string   `toml:"end"`
+		Days  []string `toml:"days"`
+	} `toml:"schedule"`
+
+	Wallpaper struct {
+		Enabled         bool     `toml:"enabled"`
+		WorkDir         string   `toml:"work_dir"`
+		Path            string   `toml:"path"`
+		Step            Duration `toml:"step"`
+		Interval        Duration `toml:"interval"`
+		MinTickInterval Duration `toml:"min_tick_interval"`
+		Theme           string   `toml:"theme"`
+		Style           string   `toml:"style"`
+		Easing          string   `toml:"easing"`
+		Direction       string   `toml:"direction"`
+		RTL             bool     `toml:"rtl"`
+		Format          string   `toml:"format"`
+		Quality         int      `toml:"quality"`
+		Cache           bool     `toml:"cache"`
+		Times           []string `toml:"times"`
+		Foregrounds     []string `toml:"foregrounds"`
+		Backgrounds     []string `toml:"backgrounds"`
+		DarkBackgrounds []string `toml:"dark_backgrounds"`
+		Width           int      `toml:"width"`
+		Height          int      `toml:"height"`
+		Scale           float64  `toml:"scale"`
+		AutoScale       bool     `toml:"auto_scale"`
+
+		TransitionFrames   int      `toml:"transition_frames"`
+		TransitionDuration Duration `toml:"transition_duration"`
+
+		DividerColor string `toml:"divider_color"`
+		DividerWidth int    `toml:"divider_width"`
+
+		GradientFrom string `toml:"gradient_from"`
+		GradientTo   string `toml:"gradient_to"`
+		ImagePath    string `toml:"image_path"`
+		TomatoCount  int    `toml:"tomato_count"`
+
+		WatermarkPath     string `toml:"watermark_path"`
+		WatermarkPosition string `toml:"watermark_position"`
+
+		Volatile     bool   `toml:"volatile"`
+		VolatilePath string `toml:"volatile_path"`
+
+		Setter         string `toml:"setter"`
+		LockScreen     bool   `toml:"lock_screen"`
+		StatusIconPath string `toml:"status_icon_path"`
+		Archive        bool   `toml:"archive"`
+
+		MaxCachedWallpapers int `toml:"max_cached_wallpapers"`
+	} `toml:"wallpaper"`
+
+	MenuBar struct {
+		Enabled   bool     `toml:"enabled"`
+		FlashOnly bool     `toml:"flash_only"`
+		Urgent    bool     `toml:"urgent"`
+		Step      Duration `toml:"step"`
+		Interval  Duration `toml:"interval"`
+	} `toml:"menu_bar"`
+
+	Announcement struct {
+		Enabled  bool     `toml:"enabled"`
+		Interval Duration `toml:"interval"`
+		Voice    string   `toml:"voice"`
+		Source   string   `toml:"source"`
+		Subtitle string   `toml:"subtitle"`
+		Sound    string   `toml:"sound"`
+
+		TimeFormat string `toml:"time_format"`
+	} `toml:"announcement"`
+
+	Speech struct {
+		Enabled  bool     `toml:"enabled"`
+		Interval Duration `toml:"interval"`
+		Text     string   `toml:"text"`
+		Voice    string   `toml:"voice"`
+	} `toml:"speech"`
+
+	Countdown struct {
+		Enabled  bool       `toml:"enabled"`
+		Step     Duration   `toml:"step"`
+		Interval Duration   `toml:"interval"`
+		At       []Duration `toml:"at"`
+	} `toml:"countdown"`
+
+	NightShift struct {
+		Enabled  bool     `toml:"enabled"`
+		Step     Duration `toml:"step"`
+		Interval Duration `toml:"interval"`
+		After    string   `toml:"after"`
+		Until    string   `toml:"until"`
+	} `toml:"night_shift"`
+
+	AccentColor struct {
+		Enabled  bool     `toml:"enabled"`
+		Colors   []string `toml:"colors"`
+		Step     Duration `toml:"step"`
+		Interval Duration `toml:"interval"`
+	} `toml:"accent_color"`
+
+	TouchBar struct {
+		Enabled  bool     `toml:"enabled"`
+		Step     Duration `toml:"step"`
+		Interval Duration `toml:"interval"`
+	} `toml:"touch_bar"`
+
+	DesktopIcons struct {
+		Enabled  bool     `toml:"enabled"`
+		Step     Duration `toml:"step"`
+		Interval Duration `toml:"interval"`
+	} `toml:"desktop_icons"`
+
+	MenuBarAutohide struct {
+		Enabled  bool     `toml:"enabled"`
+		Step     Duration `toml:"step"`
+		Interval Duration `toml:"interval"`
+	} `toml:"menu_bar_autohide"`
+
+	Overlay struct {
+		Enabled  bool     `toml:"enabled"`
+		Helper   string   `toml:"helper"`
+		Step     Duration `toml:"step"`
+		Interval Duration `toml:"interval"`
+	} `toml:"overlay"`
+
+	Socket struct {
+		Enabled  bool     `toml:"enabled"`
+		Path     string   `toml:"path"`
+		Step     Duration `toml:"step"`
+		Interval Duration `toml:"interval"`
+	} `toml:"socket"`
+
+	TaskFile struct {
+		Enabled  bool     `toml:"enabled"`
+		Path     string   `toml:"path"`
+		Labels   []string `toml:"labels"`
+		Step     Duration `toml:"step"`
+		Interval Duration `toml:"interval"`
+	} `toml:"task_file"`
+
+	StatusText struct {
+		Enabled     bool     `toml:"enabled"`
+		Path        string   `toml:"path"`
+		MinFontSize int      `toml:"min_font_size"`
+		MaxFontSize int      `toml:"max_font_size"`
+		Step        Duration `toml:"step"`
+		Interval    Duration `toml:"interval"`
+	} `toml:"status_text"`
+
+	ITermBadge struct {
+		Enabled  bool     `toml:"enabled"`
+		Step     Duration `toml:"step"`
+		Interval Duration `toml:"interval"`
+	} `toml:"iterm_badge"`
+
+	Console struct {
+		Enabled  bool     `toml:"enabled"`
+		Step     Duration `toml:"step"`
+		Interval Duration `toml:"interval"`
+	} `toml:"console"`
+
+	OTel struct {
+		Endpoint    string `toml:"endpoint"`
+		ServiceName string `toml:"service_name"`
+	} `toml:"otel"`
+
+	Commands []CommandConfig `toml:"command"`
+}
+
+// CommandConfig represents the settings for a user-defined command.
+type CommandConfig struct {
+	Name     string   `toml:"name"`
+	Type     string   `toml:"type"`
+	Path     string   `toml:"path"`
+	Args     []string `toml:"args"`
+	Step     Duration `toml:"step"`
+	Interval Duration `toml:"interval"`
+}
+
+// LogEntry represents a single structured log line.
+type LogEntry struct {
+	Timestamp time.Time `json:"ts"`
+	Level     string    `json:"level"`
+	Message   string    `json:"msg"`
+	Command   string    `json:"command,omitempty"`
+}
+
+// JSONLogWriter wraps each line written to it in a JSON log entry.
+// Lines that are already JSON objects are passed through unchanged.
+type JSONLogWriter struct {
+	W   io.Writer
+	Now func() time.Time
+}
+
+// Write writes p as an informational log entry to the underlying writer.
+func (w *JSONLogWriter) Write(p []byte) (int, error) {
+	// Only objects are passed through so that messages which happen to be
+	// valid JSON, such as a bare number, are still wrapped.
+	if bytes.HasPrefix(p, []byte("{")) && json.Valid(p) {
+		return w.W.Write(p)
+	}
+
+	b, err := json.Marshal(LogEntry{
+		Timestamp: w.Now().UTC(),
+		Level:     "info",
+		Message:   strings.TrimSuffix(string(p), "\n"),
+	})
+	if err != nil {
+		return 0, err
+	} else if _, err := w.W.Write(append(b, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Metrics counts ticker activity and serves it in the Prometheus text format.
+type Metrics struct {
+	mu        sync.Mutex
+	ticks     int
+	intervals map[string]int
+	errors    map[string]int
+}
+
+// NewMetrics returns a new instance of Metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		intervals: make(map[string]int),
+		errors:    make(map[string]int),
+	}
+}
+
+// IncTicks increments the number of ticks executed.
+func (m *Metrics) IncTicks() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ticks++
+}
+
+// IncIntervals increments the number of intervals completed by a command.
+func (m *Metrics) IncIntervals(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.intervals[name]++
+}
+
+// IncErrors increments the number of handler errors for a command.
+func (m *Metrics) IncErrors(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errors[name]++
+}
+
+// ServeHTTP writes the current counter values.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# HELP boxer_ticks_total Number of ticks executed.")
+	fmt.Fprintln(w, "# TYPE boxer_ticks_total counter")
+	fmt.Fprintf(w, "boxer_ticks_total %d\n", m.ticks)
+	writeCommandCounter(w, "boxer_intervals_completed_total", "Number of intervals completed per command.", m.intervals)
+	writeCommandCounter(w, "boxer_handler_errors_total", "Number of handler errors per command.", m.errors)
+}
+
+// writeCommandCounter writes a counter with a value for each command name.
+func writeCommandCounter(w io.Writer, name, help string, values map[string]int) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", name)
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{command=%q} %d\n", name, k, values[k])
+	}
+}
+
+// DefaultStreamWriteTimeout is the time allowed to send a message to a status
+// stream client before it is disconnected.
+const DefaultStreamWriteTimeout = 5 * time.Second
+
+// websocketGUID is appended to a client's key to compute the handshake
+// response, as defined by RFC 6455.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// StatusStream serves WebSocket connections and broadcasts status messages
+// to every connected client. Clients are removed when they disconnect or when
+// a message cannot be written to them.
+type StatusStream struct {
+	mu      sync.Mutex
+	clients map[net.Conn]struct{}
+
+	// The time allowed to write a message to a single client.
+	WriteTimeout time.Duration
+}
+
+// NewStatusStream returns a new instance of StatusStream.
+func NewStatusStream() *StatusStream {
+	return &StatusStream{
+		clients:      make(map[net.Conn]struct{}),
+		WriteTimeout: DefaultStreamWriteTimeout,
+	}
+}
+
+// ServeHTTP upgrades the request to a WebSocket connection and adds it to the
+// set of clients receiving broadcasts.
+func (s *StatusStream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || key == "" {
+		http.Error(w, "websocket upgrade required", http.StatusBadRequest)
+		return
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return
+	}
+
+	// Register the client before completing the handshake so that it receives
+	// every broadcast after the handshake is read.
+	s.mu.Lock()
+	s.clients[conn] = struct{}{}
+	s.mu.Unlock()
+
+	h := sha1.Sum([]byte(key + websocketGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", base64.StdEncoding.EncodeToString(h[:]))
+	if err := rw.Flush(); err != nil {
+		s.remove(conn)
+		return
+	}
+
+	// Discard client messages until the client closes the connection.
+	go func() {
+		defer s.remove(conn)
+		for {
+			if opcode, err := discardFrame(rw.Reader); err != nil || opcode == 0x8 {
+				return
+			}
+		}
+	}()
+}
+
+// Broadcast sends msg as a text message to every connected client.
+func (s *StatusStream) Broadcast(msg []byte) {
+	frame := textFrame(msg)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.clients {
+		conn.SetWriteDeadline(time.Now().Add(s.WriteTimeout))
+		if _, err := conn.Write(frame); err != nil {
+			conn.Close()
+			delete(s.clients, conn)
+		}
+	}
+}
+
+// Close disconnects all clients.
+func (s *StatusStream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.clients {
+		conn.Close()
+		delete(s.clients, conn)
+	}
+	return nil
+}
+
+// remove disconnects conn and removes it from the set of clients.
+func (s *StatusStream) remove(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conn.Close()
+	delete(s.clients, conn)
+}
+
+// textFrame returns msg encoded as a single unmasked WebSocket text frame.
+func textFrame(msg []byte) []byte {
+	b := []byte{0x81} // fin + text
+	switch n := len(msg); {
+	case n < 126:
+		b = append(b, byte(n))
+	case n <= 0xFFFF:
+		b = append(b, 126, 0, 0)
+		binary.BigEndian.PutUint16(b[2:], uint16(n))
+	default:
+		b = append(b, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(b[2:], uint64(n))
+	}
+	return append(b, msg...)
+}
+
+// discardFrame reads a single WebSocket frame from r and returns its opcode.
+func discardFrame(r *bufio.Reader) (opcode byte, err error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, err
+	}
+
+	n := uint64(hdr[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if hdr[1]&0x80 != 0 {
+		n += 4 // masking key
+	}
+
+	if _, err := io.CopyN(ioutil.Discard, r, int64(n)); err != nil {
+		return 0, err
+	}
+	return hdr[0] & 0x0F, nil
+}
+
+// Default settings for exporting spans to an OpenTelemetry collector.
+const (
+	DefaultOTelServiceName = "boxer"
+	DefaultOTelBatchSize   = 100
+)
+
+// OTLPTracer exports ticker spans to an OpenTelemetry collector using OTLP
+// over HTTP with JSON encoding. Every root span starts a new trace. Ended spans
+// are exported in the background once a batch is full and when the tracer is
+// flushed or closed.
+type OTLPTracer struct {
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	pending []*otlpSpan // ended spans waiting to be exported
+
+	// Base URL of the collector, such as "http://localhost:4318". Spans are
+	// posted to the "/v1/traces" path.
+	Endpoint string
+
+	// The service name reported with every span.
+	ServiceName string
+
+	// The number of ended spans that triggers an export.
+	BatchSize int
+
+	Client *http.Client
+	Logger *log.Logger
+}
+
+// Ensure the tracer can be used by the ticker.
+var _ boxer.Tracer = &OTLPTracer{}
+
+// NewOTLPTracer returns a new instance of OTLPTracer exporting to endpoint.
+func NewOTLPTracer(endpoint string) *OTLPTracer {
+	return &OTLPTracer{
+		Endpoint:    endpoint,
+		ServiceName: DefaultOTelServiceName,
+		BatchSize:   DefaultOTelBatchSize,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		Logger:      log.New(ioutil.Discard, "", 0),
+	}
+}
+
+// StartSpan starts a new trace with a root span.
+func (t *OTLPTracer) StartSpan(name string, attrs map[string]interface{}) boxer.Span {
+	return t.startSpan(randomHex(16), "", name, attrs)
+}
+
+func (t *OTLPTracer) startSpan(traceID, parentID, name string, attrs map[string]interface{}) *otlpSpan {
+	return &otlpSpan{tracer: t, start: time.Now(), otlpSpanJSON: otlpSpanJSON{
+		TraceID:      traceID,
+		SpanID:       randomHex(8),
+		ParentSpanID: parentID,
+		Name:         name,
+		Kind:         1, // internal
+		Attributes:   otlpAttributes(attrs),
+	}}
+}
+
+// end queues an ended span and exports the queue in the background once the
+// batch is full.
+func (t *OTLPTracer) end(s *otlpSpan) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.pending = append(t.pending, s); len(t.pending) < t.BatchSize {
+		return
+	}
+	spans := t.pending
+	t.pending = nil
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		if err := t.export(spans); err != nil {
+			t.Logger.Printf("otel: %s", err)
+		}
+	}()
+}
+
+// Flush exports all ended spans and waits for background exports to finish.
+func (t *OTLPTracer) Flush() error {
+	t.mu.Lock()
+	spans := t.pending
+	t.pending = nil
+	t.mu.Unlock()
+
+	err := t.export(spans)
+	t.wg.Wait()
+	return err
+}
+
+// Close exports any remaining spans.
+func (t *OTLPTracer) Close() error {
+	return t.Flush()
+}
+
+// export posts spans to the collector.
+func (t *OTLPTracer) export(spans []*otlpSpan) error {
+	if len(spans) == 0 {
+		return nil
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": otlpAttributes(map[string]interface{}{"service.name": t.ServiceName}),
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "boxer"},
+				"spans": spans,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := t.Client.Post(strings.TrimSuffix(t.Endpoint, "/")+"/v1/traces", "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
+
+// otlpSpan represents a span recorded by OTLPTracer. It is encoded in the
+// OTLP JSON format once ended.
+type otlpSpan struct {
+	tracer *OTLPTracer
+	start  time.Time
+	otlpSpanJSON
+}
+
+// StartSpan starts a child span within the same trace.
+func (s *otlpSpan) StartSpan(name string, attrs map[string]interface{}) boxer.Span {
+	return s.tracer.startSpan(s.TraceID, s.SpanID, name, attrs)
+}
+
+// End ends the span and queues it for export.
+func (s *otlpSpan) End(err error) {
+	s.StartTimeUnixNano = strconv.FormatInt(s.start.UnixNano(), 10)
+	s.EndTimeUnixNano = strconv.FormatInt(time.Now().UnixNano(), 10)
+	s.Status.Code = 1 // ok
+	if err != nil {
+		s.Status.Code, s.Status.Message = 2, err.Error() // error
+	}
+	s.tracer.end(s)
+}
+
+type otlpSpanJSON struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes"`
+	Status            struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	} `json:"status"`
+}
+
+type otlpKeyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+// otlpAttributes converts attrs to OTLP key/value pairs sorted by key.
+func otlpAttributes(attrs map[string]interface{}) []otlpKeyValue {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	a := make([]otlpKeyValue, len(keys))
+	for i, k := range keys {
+		a[i].Key = k
+		switch v := attrs[k].(type) {
+		case string:
+			a[i].Value = map[string]interface{}{"stringValue": v}
+		case int:
+			a[i].Value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case float64:
+			a[i].Value = map[string]interface{}{"doubleValue": v}
+		case bool:
+			a[i].Value = map[string]interface{}{"boolValue": v}
+		default:
+			a[i].Value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+	}
+	return a
+}
+
+// randomHex returns n random bytes encoded as hex, used for trace & span IDs.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// ConfigCheck is the result of validating a single config field.
+type ConfigCheck struct {
+	Field string
+	Err   error
+}
+
+// Check validates each field of the config and returns the results.
+func (c *Config) Check() []ConfigCheck {
+	var a []ConfigCheck
+
+	// Validate anchor & wallpaper times of day.
+	if c.AnchorTime != "" {
+		a = append(a, checkTime("anchor_time", c.AnchorTime))
+	}
+	if c.Rounding != "" {
+		_, err := boxer.ParseRounding(c.Rounding)
+		a = append(a, ConfigCheck{Field: "rounding", Err: err})
+	}
+	if c.Schedule.Start != "" || c.Schedule.End != "" {
+		a = append(a, checkTime("schedule.start", c.Schedule.Start))
+		a = append(a, checkTime("schedule.end", c.Schedule.End))
+	}
+	if len(c.Schedule.Days) > 0 {
+		_, err := boxer.ParseWeekdays(c.Schedule.Days)
+		a = append(a, ConfigCheck{Field: "schedule.days", Err: err})
+	}
+	for i, s := range c.Wallpaper.Times {
+		a = append(a, checkTime(fmt.Sprintf("wallpaper.times[%d]", i), s))
+	}
+
+	// Validate the announcement time layout.
+	if c.Announcement.TimeFormat != "" {
+		a = append(a, checkTimeFormat("announcement.time_format", c.Announcement.TimeFormat))
+	}
+
+	// Validate wallpaper colors.
+	for i, s := range c.Wallpaper.Foregrounds {
+		if !strings.EqualFold(s, boxer.AutoColor) {
+			a = append(a, checkColor(fmt.Sprintf("wallpaper.foregrounds[%d]", i), s))
+		}
+	}
+	for i, s := range c.Wallpaper.Backgrounds {
+		a = append(a, checkColor(fmt.Sprintf("wallpaper.backgrounds[%d]", i), s))
+	}
+	for i, s := range c.Wallpaper.DarkBackgrounds {
+		a = append(a, checkColor(fmt.Sprintf("wallpaper.dark_backgrounds[%d]", i), s))
+	}
+	if c.Wallpaper.DividerColor != "" {
+		a = append(a, checkColor("wallpaper.divider_color", c.Wallpaper.DividerColor))
+	}
+	if c.Wallpaper.Easing != "" {
+		_, err := boxer.ParseEasing(c.Wallpaper.Easing)
+		a = append(a, ConfigCheck{Field: "wallpaper.easing", Err: err})
+	}
+	for i, s := range c.AccentColor.Colors {
+		a = append(a, checkColor(fmt.Sprintf("accent_color.colors[%d]", i), s))
+	}
+
+	// Validate command durations.
+	a = append(a, checkDurations("wallpaper", c.Wallpaper.Step, c.Wallpaper.Interval)...)
+	a = append(a, checkDurations("menu_bar", c.MenuBar.Step, c.MenuBar.Interval)...)
+	if c.MenuBar.Urgent {
+		chk := ConfigCheck{Field: "menu_bar.urgent"}
+		if c.MenuBar.Step.Duration == 0 {
+			chk.Err = fmt.Errorf("requires a step")
+		}
+		a = append(a, chk)
+	}
+	a = append(a, checkDurations("announcement", Duration{}, c.Announcement.Interval)...)
+	a = append(a, checkDurations("speech", Duration{}, c.Speech.Interval)...)
+	a = append(a, checkDurations("countdown", c.Countdown.Step, c.Countdown.Interval)...)
+	a = append(a, checkDurations("night_shift", c.NightShift.Step, c.NightShift.Interval)...)
+	a = append(a, checkTime("night_shift.after", c.NightShift.After))
+	a = append(a, checkTime("night_shift.until", c.NightShift.Until))
+	a = append(a, checkDurations("accent_color", c.AccentColor.Step, c.AccentColor.Interval)...)
+	a = append(a, checkDurations("touch_bar", c.TouchBar.Step, c.TouchBar.Interval)...)
+	a = append(a, checkDurations("desktop_icons", c.DesktopIcons.Step, c.DesktopIcons.Interval)...)
+	a = append(a, checkDurations("menu_bar_autohide", c.MenuBarAutohide.Step, c.MenuBarAutohide.Interval)...)
+	a = append(a, checkDurations("overlay", c.Overlay.Step, c.Overlay.Interval)...)
+	a = append(a, checkDurations("socket", c.Socket.Step, c.Socket.Interval)...)
+	a = append(a, checkDurations("task_file", c.TaskFile.Step, c.TaskFile.Interval)...)
+	a = append(a, checkDurations("status_text", c.StatusText.Step, c.StatusText.Interval)...)
+	a = append(a, checkDurations("iterm_badge", c.ITermBadge.Step, c.ITermBadge.Interval)...)
+	a = append(a, checkDurations("console", c.Console.Step, c.Console.Interval)...)
+
+	return a
+}
+
+// checkTime validates a time of day in the "3:04pm" format.
+func checkTime(field, s string) ConfigCheck {
+	_, err := time.Parse("3:04pm", s)
+	return ConfigCheck{Field: field, Err: err}
+}
+
+// checkTimeFormat validates that a time layout contains at least one time
+// element so the formatted time is not just the literal layout.
+func checkTimeFormat(field, layout string) ConfigCheck {
+	chk := ConfigCheck{Field: field}
+	if time.Now().Format(layout) == layout {
+		chk.Err = fmt.Errorf("no time elements in layout: %q", layout)
+	}
+	return chk
+}
+
+// checkColor validates a color.
+func checkColor(field, s string) ConfigCheck {
+	_, err := boxer.ParseColor(s)
+	return ConfigCheck{Field: field, Err: err}
+}
+
+// checkDurations validates that the interval is positive and that the step,
+// if set, is positive and no greater than the interval.
+func checkDurations(section string, step, interval Duration) []ConfigCheck {
+	a := []ConfigCheck{{Field: section + ".interval"}}
+	if interval.Duration <= 0 {
+		a[0].Err = fmt.Errorf("must be positive: %s", interval)
+	}
+
+	if step != (Duration{}) {
+		chk := ConfigCheck{Field: section + ".step"}
+		if step.Duration <= 0 {
+			chk.Err = fmt.Errorf("must be positive: %s", step)
+		} else if step.Duration > interval.Duration {
+			chk.Err = fmt.Errorf("must not be greater than interval: %s > %s", step, interval)
+		} else if interval.Duration%step.Duration != 0 {
+			chk.Err = fmt.Errorf("must divide evenly into interval: %s / %s", interval, step)
+		}
+		a = append(a, chk)
+	}
+	return a
+}
+
+// NewConfig returns an instance of Config with default settings.
+func NewConfig() *Config {
+	var c Config
+
+	c.Wallpaper.Enabled = false
+	c.Wallpaper.Step = Duration{1 * time.Minute}
+	c.Wallpaper.Interval = Duration{15 * time.Minute}
+	c.Wallpaper.Cache = true
+	c.Wallpaper.TomatoCount = 8
+
+	c.MenuBar.Enabled = false
+	c.MenuBar.Interval = Duration{15 * time.Minute}
+
+	c.Announcement.Enabled = false
+	c.Announcement.Interval = Duration{30 * time.Minute}
+
+	c.Speech.Enabled = false
+	c.Speech.Interval = Duration{30 * time.Minute}
+	c.Speech.Text = "Break time"
+
+	c.Countdown.Enabled = false
+	c.Countdown.Step = Duration{1 * time.Minute}
+	c.Countdown.Interval = Duration{30 * time.Minute}
+	c.Countdown.At = []Duration{{5 * time.Minute}, {1 * time.Minute}}
+
+	c.NightShift.Enabled = false
+	c.NightShift.Step = Duration{1 * time.Minute}
+	c.NightShift.Interval = Duration{30 * time.Minute}
+	c.NightShift.After = "7:00pm"
+	c.NightShift.Until = "7:00am"
+
+	c.AccentColor.Enabled = false
+	c.AccentColor.Step = Duration{1 * time.Minute}
+	c.AccentColor.Interval = Duration{15 * time.Minute}
+
+	c.TouchBar.Enabled = false
+	c.TouchBar.Step = Duration{1 * time.Minute}
+	c.TouchBar.Interval = Duration{15 * time.Minute}
+
+	c.DesktopIcons.Enabled = false
+	c.DesktopIcons.Step = Duration{1 * time.Minute}
+	c.DesktopIcons.Interval = Duration{30 * time.Minute}
+
+	c.MenuBarAutohide.Enabled = false
+	c.MenuBarAutohide.Step = Duration{1 * time.Minute}
+	c.MenuBarAutohide.Interval = Duration{30 * time.Minute}
+
+	c.Overlay.Enabled = false
+	c.Overlay.Step = Duration{1 * time.Minute}
+	c.Overlay.Interval = Duration{15 * time.Minute}
+
+	c.Socket.Enabled = false
+	c.Socket.Step = Duration{1 * time.Minute}
+	c.Socket.Interval = Duration{15 * time.Minute}
+
+	c.TaskFile.Enabled = false
+	c.TaskFile.Step = Duration{1 * time.Minute}
+	c.TaskFile.Interval = Duration{30 * time.Minute}
+
+	c.StatusText.Enabled = false
+	c.StatusText.Step = Duration{1 * time.Minute}
+	c.StatusText.Interval = Duration{15 * time.Minute}
+
+	c.ITermBadge.Enabled = false
+	c.ITermBadge.Step = Duration{1 * time.Minute}
+	c.ITermBadge.Interval = Duration{15 * time.Minute}
+
+	c.Console.Enabled = false
+	c.Console.Step = Duration{1 * time.Minute}
+	c.Console.Interval = Duration{15 * time.Minute}
+
+	return &c
+}
+
+// Duration is used by the TOML config to parse duration values.
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+
+	d.Duration = v
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.Duration.String()), nil
+}
+
 func warn(v ...interface{})              { fmt.Fprintln(os.Stderr, v...) }
 func warnf(msg string, v ...interface{}) { fmt.Fprintf(os.Stderr, msg+"\n", v...) }
@@ -1,10 +1,31 @@
 package main_test
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/benbjohnson/boxer"
 	"github.com/benbjohnson/boxer/cmd/boxer"
 )
 
@@ -30,3 +51,2022 @@ interval = "1h"
 		t.Fatalf("unexpected wallpaper.interval: %v", config.Wallpaper.Interval)
 	}
 }
+
+// Ensure the anchor time is applied to the ticker.
+func TestNewTicker_AnchorTime(t *testing.T) {
+	config := main.NewConfig()
+	config.AnchorTime = "9:00am"
+
+	ticker, err := main.NewTicker(config, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if ticker.Anchor.Hour() != 9 || ticker.Anchor.Minute() != 0 {
+		t.Fatalf("unexpected anchor: %s", ticker.Anchor)
+	}
+}
+
+// Ensure the main clock is used for the anchor date and by time-of-day handlers.
+func TestMain_Reload_Clock(t *testing.T) {
+	path := MustWriteTempFile(`
+anchor_time = "9:00am"
+
+[night_shift]
+enabled  = true
+step     = "1m"
+interval = "30m"
+after    = "7:00pm"
+`)
+	defer os.Remove(path)
+
+	var n int
+	m := main.NewMain()
+	m.ConfigPath = path
+	m.Executor = func(name string, args []string, stdin io.Reader) ([]byte, error) { n++; return nil, nil }
+	m.Clock = &Clock{now: time.Date(2000, time.January, 1, 18, 0, 0, 0, time.Local)}
+	if err := m.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	ticker := m.Ticker()
+	if exp := time.Date(2000, time.January, 1, 9, 0, 0, 0, time.Local); !ticker.Anchor.Equal(exp) {
+		t.Fatalf("unexpected anchor: %s", ticker.Anchor)
+	} else if !ticker.Now().Equal(m.Clock.Now()) {
+		t.Fatalf("unexpected ticker time: %s", ticker.Now())
+	}
+
+	// Verify night shift is skipped before 7pm on the main clock.
+	cmd, _ := ticker.Command("night_shift")
+	if err := cmd.Handler(1, 30); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatalf("unexpected exec count: %d", n)
+	}
+
+	m.Clock.(*Clock).now = time.Date(2000, time.January, 1, 20, 0, 0, 0, time.Local)
+	if err := cmd.Handler(1, 30); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("unexpected exec count: %d", n)
+	}
+}
+
+// Ensure an invalid anchor time returns an error.
+func TestNewTicker_ErrAnchorTime(t *testing.T) {
+	config := main.NewConfig()
+	config.AnchorTime = "bad"
+
+	if _, err := main.NewTicker(config, nil); err == nil || err.Error() != `parse anchor time: parsing time "bad" as "3:04pm": cannot parse "bad" as "3"` {
+		t.Fatal(err)
+	}
+}
+
+// Ensure the rounding setting is used for the remaining time in status text.
+func TestNewTicker_Rounding(t *testing.T) {
+	path := MustWriteTempFile(``)
+	defer os.Remove(path)
+
+	config := main.NewConfig()
+	config.Rounding = "ceil"
+	config.StatusText.Enabled = true
+	config.StatusText.Path = path
+	config.StatusText.Step = main.Duration{30 * time.Second}
+
+	ticker, err := main.NewTicker(config, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := ticker.Commands[0].Handler(0, 3); err != nil {
+		t.Fatal(err)
+	} else if b, err := ioutil.ReadFile(path); err != nil {
+		t.Fatal(err)
+	} else if string(b) != "2m left\n" {
+		t.Fatalf("unexpected contents: %q", b)
+	}
+}
+
+// Ensure an invalid rounding method returns an error.
+func TestNewTicker_ErrRounding(t *testing.T) {
+	config := main.NewConfig()
+	config.Rounding = "up"
+
+	if _, err := main.NewTicker(config, nil); err == nil || err.Error() != `parse rounding: invalid rounding: "up"` {
+		t.Fatal(err)
+	}
+}
+
+// Ensure urgent menu bar flashing without a step returns an error.
+func TestNewTicker_ErrMenuBarUrgent(t *testing.T) {
+	config := main.NewConfig()
+	config.MenuBar.Enabled = true
+	config.MenuBar.Urgent = true
+
+	if _, err := main.NewTicker(config, nil); err == nil || err.Error() != `menu bar: urgent requires a step` {
+		t.Fatal(err)
+	}
+}
+
+// Ensure an unwritable work directory returns an error at startup even when
+// no handler writes to it.
+func TestNewTicker_ErrWorkDirNotWritable(t *testing.T) {
+	// Use a regular file as the work directory so it cannot be written to,
+	// even when running as root.
+	path := MustWriteTempFile(``)
+	defer os.Remove(path)
+
+	config := main.NewConfig()
+	config.WorkDir = path
+
+	if _, err := main.NewTicker(config, nil); err == nil || !strings.HasPrefix(err.Error(), "work dir not writable: ") {
+		t.Fatal(err)
+	}
+}
+
+// Ensure an unwritable wallpaper directory returns an error at startup.
+func TestNewTicker_ErrWallpaperDirNotWritable(t *testing.T) {
+	path := MustWriteTempFile(``)
+	defer os.Remove(path)
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := main.NewConfig()
+	config.WorkDir = dir
+	config.Wallpaper.WorkDir = path
+	config.Wallpaper.Enabled = true
+	config.Wallpaper.Foregrounds = []string{"#000000"}
+	config.Wallpaper.Backgrounds = []string{"#FFFFFF"}
+
+	if _, err := main.NewTicker(config, nil); err == nil || !strings.HasPrefix(err.Error(), "wallpaper dir not writable: ") {
+		t.Fatal(err)
+	}
+}
+
+// Ensure the schedule is applied to the ticker.
+func TestNewTicker_Schedule(t *testing.T) {
+	config := main.NewConfig()
+	config.Schedule.Start = "9:00am"
+	config.Schedule.End = "5:30pm"
+
+	ticker, err := main.NewTicker(config, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(*ticker.Schedule, boxer.Schedule{Start: 9 * time.Hour, End: 17*time.Hour + 30*time.Minute}) {
+		t.Fatalf("unexpected schedule: %+v", ticker.Schedule)
+	}
+}
+
+// Ensure the wallpaper work directory overrides the global work directory.
+func TestNewTicker_WallpaperWorkDir(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	config := main.NewConfig()
+	config.WorkDir = filepath.Join(path, "global")
+	config.Wallpaper.Enabled = true
+	config.Wallpaper.WorkDir = filepath.Join(path, "override")
+	config.Wallpaper.Foregrounds = []string{"#000000"}
+	config.Wallpaper.Backgrounds = []string{"#FFFFFF"}
+
+	// Return a small desktop size and ignore setting the wallpaper.
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		return []byte("0, 0, 10, 10\n"), nil
+	}
+
+	ticker, err := main.NewTicker(config, exec)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := ticker.Commands[0].Handler(0, 15); err != nil {
+		t.Fatal(err)
+	}
+
+	// Verify the wallpaper was written to the override directory. The global
+	// work directory is only probed at startup.
+	if _, err := os.Stat(filepath.Join(path, "override", "wallpaper")); err != nil {
+		t.Fatal(err)
+	} else if fis, err := ioutil.ReadDir(filepath.Join(path, "global")); err != nil {
+		t.Fatal(err)
+	} else if len(fis) != 0 {
+		t.Fatalf("unexpected global work dir files: %v", fis)
+	}
+}
+
+// Ensure the wallpaper path overrides the default wallpaper directory.
+func TestNewTicker_WallpaperPath(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		return []byte("0, 0, 10, 10\n"), nil
+	}
+
+	// Verify both absolute paths and paths relative to the work directory.
+	for _, p := range []string{filepath.Join(path, "absolute"), "relative"} {
+		config := main.NewConfig()
+		config.WorkDir = path
+		config.Wallpaper.Enabled = true
+		config.Wallpaper.Path = p
+		config.Wallpaper.Foregrounds = []string{"#000000"}
+		config.Wallpaper.Backgrounds = []string{"#FFFFFF"}
+
+		ticker, err := main.NewTicker(config, exec)
+		if err != nil {
+			t.Fatal(err)
+		} else if err := ticker.Commands[0].Handler(0, 15); err != nil {
+			t.Fatal(err)
+		}
+
+		if fis, err := ioutil.ReadDir(filepath.Join(path, filepath.Base(p))); err != nil {
+			t.Fatal(err)
+		} else if len(fis) != 1 {
+			t.Fatalf("unexpected file count: %d", len(fis))
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(path, "wallpaper")); !os.IsNotExist(err) {
+		t.Fatalf("unexpected default wallpaper dir: %v", err)
+	}
+}
+
+// Ensure volatile wallpapers are written to the volatile path instead of the
+// work directory.
+func TestNewTicker_WallpaperVolatile(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		return []byte("0, 0, 10, 10\n"), nil
+	}
+
+	config := main.NewConfig()
+	config.WorkDir = filepath.Join(path, "work")
+	config.Wallpaper.Enabled = true
+	config.Wallpaper.Volatile = true
+	config.Wallpaper.VolatilePath = filepath.Join(path, "volatile")
+	config.Wallpaper.Foregrounds = []string{"#000000"}
+	config.Wallpaper.Backgrounds = []string{"#FFFFFF"}
+
+	ticker, err := main.NewTicker(config, exec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := ticker.Commands[0].Handler(i, 15); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if fis, err := ioutil.ReadDir(filepath.Join(path, "volatile")); err != nil {
+		t.Fatal(err)
+	} else if len(fis) != 2 || fis[0].Name() != "wallpaper_live_0.png" || fis[1].Name() != "wallpaper_live_1.png" {
+		t.Fatalf("unexpected files: %v", fis)
+	} else if fis, err := ioutil.ReadDir(config.WorkDir); err != nil {
+		t.Fatal(err)
+	} else if len(fis) != 0 {
+		t.Fatalf("unexpected work dir files: %v", fis)
+	}
+}
+
+// Ensure a configured width & height bypass the display size.
+func TestNewDesktopSizer_Fixed(t *testing.T) {
+	config := main.NewConfig()
+	config.Wallpaper.Width, config.Wallpaper.Height = 1920, 1080
+	config.Wallpaper.AutoScale = true
+
+	sizer := func(exec boxer.CommandExecutor) (w, h int, err error) {
+		t.Fatal("unexpected sizer call")
+		return 0, 0, nil
+	}
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		t.Fatal("unexpected exec")
+		return nil, nil
+	}
+
+	if w, h, err := main.NewDesktopSizer(config, sizer)(exec); err != nil {
+		t.Fatal(err)
+	} else if w != 1920 || h != 1080 {
+		t.Fatalf("unexpected size: %dx%d", w, h)
+	}
+}
+
+// Ensure changing wallpaper colors changes the cached wallpaper path.
+func TestNewTicker_WallpaperKey(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	// Return a small desktop size and record the wallpaper that is set.
+	var paths []string
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		if len(args) == 0 {
+			b, _ := ioutil.ReadAll(stdin)
+			paths = append(paths, string(b))
+		}
+		return []byte("0, 0, 10, 10\n"), nil
+	}
+
+	// Generate a wallpaper for two different foreground colors.
+	for _, fg := range []string{"#000000", "#FF0000"} {
+		config := main.NewConfig()
+		config.WorkDir = path
+		config.Wallpaper.Enabled = true
+		config.Wallpaper.Foregrounds = []string{fg}
+		config.Wallpaper.Backgrounds = []string{"#FFFFFF"}
+
+		ticker, err := main.NewTicker(config, exec)
+		if err != nil {
+			t.Fatal(err)
+		} else if err := ticker.Commands[0].Handler(0, 15); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(paths) != 2 {
+		t.Fatalf("unexpected wallpaper count: %d", len(paths))
+	} else if paths[0] == paths[1] {
+		t.Fatalf("expected different wallpaper paths: %s", paths[0])
+	}
+}
+
+// Ensure the horizontal style fills from the right edge for RTL layouts.
+func TestNewTicker_WallpaperStyle_RTL(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		return []byte("0, 0, 10, 10\n"), nil
+	}
+
+	fg, white := color.RGBA{255, 0, 0, 255}, color.RGBA{255, 255, 255, 255}
+	for _, tt := range []struct {
+		direction string
+		pts       map[image.Point]color.RGBA
+	}{
+		{direction: "", pts: map[image.Point]color.RGBA{{9, 0}: fg, {0, 0}: white}},
+		{direction: "left", pts: map[image.Point]color.RGBA{{0, 0}: fg, {9, 0}: white}},
+	} {
+		config := main.NewConfig()
+		config.WorkDir = filepath.Join(path, "rtl_"+tt.direction)
+		config.Wallpaper.Enabled = true
+		config.Wallpaper.Cache = false
+		config.Wallpaper.Style = "horizontal"
+		config.Wallpaper.Direction = tt.direction
+		config.Wallpaper.RTL = true
+		config.Wallpaper.Foregrounds = []string{"#FF0000"}
+		config.Wallpaper.Backgrounds = []string{"#FFFFFF"}
+
+		ticker, err := main.NewTicker(config, exec)
+		if err != nil {
+			t.Fatal(err)
+		} else if err := ticker.Commands[0].Handler(1, 2); err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := os.Open(filepath.Join(config.WorkDir, "wallpaper", "wallpaper_live_0.png"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := png.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for pt, c := range tt.pts {
+			if v := color.RGBAModel.Convert(m.At(pt.X, pt.Y)); v != c {
+				t.Fatalf("%q: unexpected color at %s: %v", tt.direction, pt, v)
+			}
+		}
+	}
+}
+
+// Ensure the wallpaper style selects the matching generator.
+func TestNewTicker_WallpaperStyle(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	// Write a solid blue background image for the image style.
+	imagePath := filepath.Join(path, "background.png")
+	bg := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	draw.Draw(bg, bg.Bounds(), &image.Uniform{color.RGBA{0, 0, 255, 255}}, image.ZP, draw.Src)
+	if f, err := os.Create(imagePath); err != nil {
+		t.Fatal(err)
+	} else if err := png.Encode(f, bg); err != nil {
+		t.Fatal(err)
+	} else if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Return a small desktop size and ignore setting the wallpaper.
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		return []byte("0, 0, 10, 10\n"), nil
+	}
+
+	fg, white, blue := color.RGBA{255, 0, 0, 255}, color.RGBA{255, 255, 255, 255}, color.RGBA{0, 0, 255, 255}
+	for _, tt := range []struct {
+		style string
+		pts   map[image.Point]color.RGBA
+	}{
+		{style: "solid", pts: map[image.Point]color.RGBA{{0, 0}: fg, {0, 9}: white}},
+		{style: "horizontal", pts: map[image.Point]color.RGBA{{0, 0}: fg, {9, 0}: white}},
+		{style: "radial", pts: map[image.Point]color.RGBA{{5, 5}: fg, {0, 0}: white}},
+		{style: "gradient", pts: map[image.Point]color.RGBA{{0, 0}: fg, {0, 9}: blue}},
+		{style: "image", pts: map[image.Point]color.RGBA{{0, 0}: fg, {0, 9}: blue}},
+	} {
+		config := main.NewConfig()
+		config.WorkDir = filepath.Join(path, tt.style)
+		config.Wallpaper.Enabled = true
+		config.Wallpaper.Cache = false
+		config.Wallpaper.Style = tt.style
+		config.Wallpaper.Foregrounds = []string{"#FF0000"}
+		config.Wallpaper.Backgrounds = []string{"#FFFFFF"}
+		config.Wallpaper.GradientFrom = "#FFFFFF"
+		config.Wallpaper.GradientTo = "#0000FF"
+		config.Wallpaper.ImagePath = imagePath
+
+		ticker, err := main.NewTicker(config, exec)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.style, err)
+		} else if err := ticker.Commands[0].Handler(1, 2); err != nil {
+			t.Fatalf("%s: %s", tt.style, err)
+		}
+
+		// Verify the generated wallpaper was drawn in the style.
+		f, err := os.Open(filepath.Join(config.WorkDir, "wallpaper", "wallpaper_live_0.png"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := png.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for pt, c := range tt.pts {
+			if v := color.RGBAModel.Convert(m.At(pt.X, pt.Y)); v != c {
+				t.Fatalf("%s: unexpected color at %s: %v", tt.style, pt, v)
+			}
+		}
+	}
+}
+
+// Ensure the cycle style uses the next foreground color each interval.
+func TestNewTicker_WallpaperCycle(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		return []byte("0, 0, 10, 10\n"), nil
+	}
+
+	config := main.NewConfig()
+	config.WorkDir = path
+	config.Wallpaper.Enabled = true
+	config.Wallpaper.Step = main.Duration{1 * time.Minute}
+	config.Wallpaper.Interval = main.Duration{2 * time.Minute}
+	config.Wallpaper.Style = "cycle"
+	config.Wallpaper.Foregrounds = []string{"#FF0000", "#00FF00", "#0000FF"}
+	config.Wallpaper.Backgrounds = []string{"#FFFFFF"}
+
+	ticker, err := main.NewTicker(config, exec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2000, time.January, 1, 0, 1, 0, 0, time.UTC)
+	ticker.Now = func() time.Time { return now }
+
+	// Tick halfway through three intervals.
+	for j, c := range []color.RGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}} {
+		if errs := ticker.Tick(); errs != nil {
+			t.Fatal(errs)
+		}
+		now = now.Add(2 * time.Minute)
+
+		f, err := os.Open(filepath.Join(path, "wallpaper", fmt.Sprintf("wallpaper_live_%d.png", j%2)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := png.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := color.RGBAModel.Convert(m.At(0, 0)); v != c {
+			t.Fatalf("%d: unexpected color: %v", j, v)
+		}
+	}
+}
+
+// Ensure the dark backgrounds are used while the appearance is dark.
+func TestNewTicker_WallpaperDarkBackgrounds(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		if stdin != nil {
+			if b, _ := ioutil.ReadAll(stdin); strings.Contains(string(b), "appearance preferences") {
+				return []byte("Dark\n"), nil
+			}
+		}
+		return []byte("0, 0, 10, 10\n"), nil
+	}
+
+	config := main.NewConfig()
+	config.WorkDir = path
+	config.Wallpaper.Enabled = true
+	config.Wallpaper.Cache = false
+	config.Wallpaper.Foregrounds = []string{"#FF0000"}
+	config.Wallpaper.Backgrounds = []string{"#FFFFFF"}
+	config.Wallpaper.DarkBackgrounds = []string{"#000000"}
+
+	ticker, err := main.NewTicker(config, exec)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := ticker.Commands[0].Handler(1, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(filepath.Join(path, "wallpaper", "wallpaper_live_0.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := png.Decode(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := color.RGBAModel.Convert(m.At(0, 9)); v != (color.RGBA{0, 0, 0, 255}) {
+		t.Fatalf("unexpected background: %v", v)
+	}
+}
+
+// Ensure an "auto" foreground contrasts with the background.
+func TestNewTicker_WallpaperAutoForeground(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		return []byte("0, 0, 10, 10\n"), nil
+	}
+
+	for _, tt := range []struct {
+		bg  string
+		exp color.RGBA
+	}{
+		{bg: "#16425B", exp: color.RGBA{255, 255, 255, 255}},
+		{bg: "#F9D56E", exp: color.RGBA{0, 0, 0, 255}},
+	} {
+		config := main.NewConfig()
+		config.WorkDir = filepath.Join(path, tt.bg)
+		config.Wallpaper.Enabled = true
+		config.Wallpaper.Cache = false
+		config.Wallpaper.Foregrounds = []string{"auto"}
+		config.Wallpaper.Backgrounds = []string{tt.bg}
+
+		ticker, err := main.NewTicker(config, exec)
+		if err != nil {
+			t.Fatal(err)
+		} else if err := ticker.Commands[0].Handler(1, 2); err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := os.Open(filepath.Join(config.WorkDir, "wallpaper", "wallpaper_live_0.png"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := png.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		} else if v := color.RGBAModel.Convert(m.At(0, 0)); v != tt.exp {
+			t.Fatalf("%s: unexpected foreground: %v", tt.bg, v)
+		}
+	}
+}
+
+// Ensure an unknown wallpaper style returns an error.
+func TestNewTicker_ErrUnknownWallpaperStyle(t *testing.T) {
+	config := main.NewConfig()
+	config.Wallpaper.Enabled = true
+	config.Wallpaper.Style = "plaid"
+	config.Wallpaper.Foregrounds = []string{"#000000"}
+	config.Wallpaper.Backgrounds = []string{"#FFFFFF"}
+
+	if _, err := main.NewTicker(config, nil); err == nil || err.Error() != `unknown wallpaper style: "plaid"` {
+		t.Fatal(err)
+	}
+}
+
+// Ensure the configured setter's script is used to set the wallpaper.
+func TestNewTicker_WallpaperSetter(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	var scripts []string
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		if stdin != nil {
+			b, _ := ioutil.ReadAll(stdin)
+			scripts = append(scripts, string(b))
+		}
+		return []byte("0, 0, 10, 10\n"), nil
+	}
+
+	config := main.NewConfig()
+	config.WorkDir = path
+	config.Wallpaper.Enabled = true
+	config.Wallpaper.Setter = "system_events"
+	config.Wallpaper.Foregrounds = []string{"#000000"}
+	config.Wallpaper.Backgrounds = []string{"#FFFFFF"}
+
+	ticker, err := main.NewTicker(config, exec)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := ticker.Commands[0].Handler(0, 15); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(scripts) == 0 || !strings.Contains(scripts[len(scripts)-1], `tell every desktop to set picture to`) {
+		t.Fatalf("unexpected scripts: %q", scripts)
+	}
+}
+
+// Ensure an unknown wallpaper setter returns an error.
+func TestNewTicker_ErrUnknownWallpaperSetter(t *testing.T) {
+	config := main.NewConfig()
+	config.Wallpaper.Enabled = true
+	config.Wallpaper.Setter = "dock"
+	config.Wallpaper.Foregrounds = []string{"#000000"}
+	config.Wallpaper.Backgrounds = []string{"#FFFFFF"}
+
+	if _, err := main.NewTicker(config, nil); err == nil || err.Error() != `invalid wallpaper setter: "dock"` {
+		t.Fatal(err)
+	}
+}
+
+// Ensure an announcement time format without time elements returns an error.
+func TestNewTicker_ErrAnnouncementTimeFormat(t *testing.T) {
+	config := main.NewConfig()
+	config.Announcement.Enabled = true
+	config.Announcement.TimeFormat = "noon"
+
+	if _, err := main.NewTicker(config, nil); err == nil || err.Error() != `announcement.time_format: no time elements in layout: "noon"` {
+		t.Fatal(err)
+	}
+}
+
+// Ensure the validate subcommand reports invalid fields.
+func TestMain_Run_Validate(t *testing.T) {
+	path := MustWriteTempFile(`
+[wallpaper]
+step        = "30m"
+interval    = "15m"
+foregrounds = ["#000000", "bad_color"]
+
+[menu_bar]
+urgent = true
+`)
+	defer os.Remove(path)
+
+	var buf bytes.Buffer
+	m := main.NewMain()
+	m.Stdout = &buf
+	if err := m.Run([]string{"validate", "-config", path}); err == nil || err.Error() != `config has 3 invalid field(s)` {
+		t.Fatal(err)
+	}
+
+	output := buf.String()
+	if !strings.Contains(output, "ok   wallpaper.foregrounds[0]\n") {
+		t.Fatalf("expected valid foreground:\n\n%s", output)
+	} else if !strings.Contains(output, `FAIL wallpaper.foregrounds[1]: cannot parse color: "bad_color"`+"\n") {
+		t.Fatalf("expected invalid foreground:\n\n%s", output)
+	} else if !strings.Contains(output, "FAIL wallpaper.step: must not be greater than interval: 30m0s > 15m0s\n") {
+		t.Fatalf("expected invalid step:\n\n%s", output)
+	} else if !strings.Contains(output, "FAIL menu_bar.urgent: requires a step\n") {
+		t.Fatalf("expected invalid urgent:\n\n%s", output)
+	}
+}
+
+// Ensure the validate subcommand succeeds for the default config.
+func TestMain_Run_Validate_OK(t *testing.T) {
+	path := MustWriteTempFile(``)
+	defer os.Remove(path)
+
+	m := main.NewMain()
+	m.Stdout = ioutil.Discard
+	if err := m.Run([]string{"validate", "-config", path}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// MustWriteTempFile writes data to a temporary file and returns its path.
+func MustWriteTempFile(data string) string {
+	f, err := ioutil.TempFile("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(data); err != nil {
+		panic(err)
+	}
+	return f.Name()
+}
+
+// Ensure reloading the config replaces the ticker's commands.
+func TestMain_Reload(t *testing.T) {
+	path := MustWriteTempFile(``)
+	defer os.Remove(path)
+
+	// Load the initial config with no commands enabled.
+	m := main.NewMain()
+	m.ConfigPath = path
+	if err := m.Reload(); err != nil {
+		t.Fatal(err)
+	} else if n := len(m.Ticker().Commands); n != 0 {
+		t.Fatalf("unexpected command count: %d", n)
+	}
+
+	// Enable a command and reload.
+	if err := ioutil.WriteFile(path, []byte("[announcement]\nenabled = true\n"), 0666); err != nil {
+		t.Fatal(err)
+	} else if err := m.Reload(); err != nil {
+		t.Fatal(err)
+	} else if cmds := m.Ticker().Commands; len(cmds) != 1 || cmds[0].Name != "announcement" {
+		t.Fatalf("unexpected commands: %#v", cmds)
+	}
+}
+
+// Ensure the tick interval is read from the config.
+func TestMain_Reload_TickInterval(t *testing.T) {
+	path := MustWriteTempFile("tick_interval = \"5s\"\n")
+	defer os.Remove(path)
+
+	m := main.NewMain()
+	m.ConfigPath = path
+	if err := m.Reload(); err != nil {
+		t.Fatal(err)
+	} else if m.TickInterval != 5*time.Second {
+		t.Fatalf("unexpected tick interval: %s", m.TickInterval)
+	} else if m.Ticker().SleepThreshold != 5*time.Second+main.DefaultSleepMargin {
+		t.Fatalf("unexpected sleep threshold: %s", m.Ticker().SleepThreshold)
+	}
+}
+
+// Ensure the default sleep threshold allows for the minimum tick interval.
+func TestMain_Reload_SleepThreshold_MinTickInterval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := MustWriteTempFile(`
+work_dir = "` + dir + `"
+
+[wallpaper]
+enabled           = true
+foregrounds       = ["#000000"]
+backgrounds       = ["#FFFFFF"]
+min_tick_interval = "1m"
+`)
+	defer os.Remove(path)
+
+	m := main.NewMain()
+	m.Executor = func(name string, args []string, stdin io.Reader) ([]byte, error) { return nil, nil }
+	m.ConfigPath = path
+	if err := m.Reload(); err != nil {
+		t.Fatal(err)
+	} else if m.Ticker().SleepThreshold != 1*time.Minute+main.DefaultSleepMargin {
+		t.Fatalf("unexpected sleep threshold: %s", m.Ticker().SleepThreshold)
+	}
+}
+
+// Ensure a negative tick interval returns an error.
+func TestMain_Reload_ErrTickInterval(t *testing.T) {
+	path := MustWriteTempFile("tick_interval = \"-5s\"\n")
+	defer os.Remove(path)
+
+	m := main.NewMain()
+	m.ConfigPath = path
+	if err := m.Reload(); err == nil || err.Error() != "tick interval must be positive: -5s" {
+		t.Fatal(err)
+	}
+}
+
+// Ensure the existing ticker is kept if the reloaded config is invalid.
+func TestMain_Reload_ErrInvalidConfig(t *testing.T) {
+	path := MustWriteTempFile("[announcement]\nenabled = true\n")
+	defer os.Remove(path)
+
+	m := main.NewMain()
+	m.ConfigPath = path
+	if err := m.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	ticker := m.Ticker()
+
+	if err := ioutil.WriteFile(path, []byte("anchor_time = \"bad\"\n"), 0666); err != nil {
+		t.Fatal(err)
+	} else if err := m.Reload(); err == nil {
+		t.Fatal("expected error")
+	} else if m.Ticker() != ticker {
+		t.Fatal("unexpected ticker change")
+	}
+}
+
+// Ensure the bench subcommand reports the wallpaper generation time.
+func TestMain_Run_Bench(t *testing.T) {
+	path := MustWriteTempFile(`
+[wallpaper]
+foregrounds = ["#000000"]
+backgrounds = ["#FFFFFF"]
+`)
+	defer os.Remove(path)
+
+	var buf bytes.Buffer
+	m := main.NewMain()
+	m.Stdout = &buf
+	m.DesktopSizer = func(exec boxer.CommandExecutor) (w, h int, err error) { return 100, 200, nil }
+	m.Executor = func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		t.Fatal("unexpected exec")
+		return nil, nil
+	}
+	if err := m.Run([]string{"bench", "-config", path}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Verify a non-zero duration was reported.
+	if m := regexp.MustCompile(`^generated 100x200 wallpaper in (\S+)\n$`).FindStringSubmatch(buf.String()); m == nil {
+		t.Fatalf("unexpected output: %s", buf.String())
+	} else if d, err := time.ParseDuration(m[1]); err != nil {
+		t.Fatal(err)
+	} else if d <= 0 {
+		t.Fatalf("unexpected duration: %s", d)
+	}
+}
+
+// Ensure the simulate subcommand reports every interval over the duration.
+func TestMain_Run_Simulate(t *testing.T) {
+	path := MustWriteTempFile(`
+[menu_bar]
+enabled  = true
+interval = "15m"
+`)
+	defer os.Remove(path)
+
+	var waits int
+	var buf bytes.Buffer
+	m := main.NewMain()
+	m.Stdout = &buf
+	m.Clock = &Clock{
+		now: time.Date(2000, time.January, 1, 9, 0, 0, 0, time.UTC),
+		AfterFn: func(d time.Duration) <-chan time.Time {
+			if d != time.Second/3600 {
+				t.Fatalf("unexpected wait: %s", d)
+			}
+			waits++
+			ch := make(chan time.Time, 1)
+			ch <- time.Time{}
+			return ch
+		},
+	}
+	m.Executor = func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		t.Fatal("unexpected exec")
+		return nil, nil
+	}
+	if err := m.Run([]string{"simulate", "-config", path, "-duration", "1h"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := strings.Count(buf.String(), "menu_bar: interval started\n"); n != 4 {
+		t.Fatalf("unexpected interval count: %d\n%s", n, buf.String())
+	} else if !strings.HasPrefix(buf.String(), "09:00:00 menu_bar: interval started\n09:00:00 menu_bar: step 1/1\n") {
+		t.Fatalf("unexpected output: %s", buf.String())
+	} else if waits != 3600 {
+		t.Fatalf("unexpected wait count: %d", waits)
+	}
+}
+
+// Ensure the simulate subcommand does not start helpers or create directories.
+func TestMain_Run_Simulate_NoSideEffects(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := MustWriteTempFile(`
+work_dir = "` + filepath.Join(dir, "work") + `"
+
+[wallpaper]
+enabled     = true
+foregrounds = ["#000000"]
+backgrounds = ["#FFFFFF"]
+
+[overlay]
+enabled  = true
+helper   = "` + filepath.Join(dir, "no_such_helper") + `"
+interval = "15m"
+`)
+	defer os.Remove(path)
+
+	var buf bytes.Buffer
+	m := main.NewMain()
+	m.Stdout = &buf
+	m.Clock = &Clock{now: time.Date(2000, time.January, 1, 9, 0, 0, 0, time.UTC)}
+	if err := m.Run([]string{"simulate", "-config", path, "-duration", "1h", "-speed", "0"}); err != nil {
+		t.Fatal(err)
+	} else if _, err := os.Stat(filepath.Join(dir, "work")); !os.IsNotExist(err) {
+		t.Fatalf("unexpected work dir: %v", err)
+	} else if !strings.Contains(buf.String(), "overlay: interval started\n") {
+		t.Fatalf("unexpected output: %s", buf.String())
+	}
+}
+
+// Ensure the -once flag executes a single tick and returns.
+func TestMain_Run_Once(t *testing.T) {
+	path := MustWriteTempFile(`
+[[command]]
+name     = "bulbs"
+type     = "exec"
+path     = "bulbs"
+interval = "15m"
+`)
+	defer os.Remove(path)
+
+	var n int
+	m := main.NewMain()
+	m.Logger = log.New(ioutil.Discard, "", 0)
+	m.Executor = func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		n++
+		return nil, nil
+	}
+	if err := m.Run([]string{"-once", "-config", path}); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("unexpected exec count: %d", n)
+	}
+}
+
+// Ensure the -verbose flag logs every command executed.
+func TestMain_Run_Verbose(t *testing.T) {
+	path := MustWriteTempFile(`
+[[command]]
+name     = "bulbs"
+type     = "exec"
+path     = "bulbs"
+args     = ["{pct}"]
+interval = "15m"
+`)
+	defer os.Remove(path)
+
+	var buf bytes.Buffer
+	m := main.NewMain()
+	m.Logger = log.New(&buf, "", 0)
+	m.Executor = func(name string, args []string, stdin io.Reader) ([]byte, error) { return nil, nil }
+	if err := m.Run([]string{"-once", "-verbose", "-config", path}); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := buf.String(); !strings.Contains(s, "exec: bulbs 0\nexit: bulbs: ok\n") {
+		t.Fatalf("unexpected log: %s", s)
+	} else if !strings.Contains(s, "command=bulbs dur=") {
+		t.Fatalf("expected handler duration: %s", s)
+	}
+}
+
+// Ensure the -once flag returns handler errors.
+func TestMain_Run_Once_Err(t *testing.T) {
+	path := MustWriteTempFile(`
+[[command]]
+name     = "bulbs"
+type     = "exec"
+path     = "bulbs"
+interval = "15m"
+`)
+	defer os.Remove(path)
+
+	m := main.NewMain()
+	m.Logger = log.New(ioutil.Discard, "", 0)
+	m.Executor = func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		return nil, errors.New("exit status 1")
+	}
+	if err := m.Run([]string{"-once", "-config", path}); err == nil || err.Error() != "bulbs: exec bulbs: exit status 1" {
+		t.Fatal(err)
+	}
+}
+
+// Ensure the -work-dir flag overrides the work directory in the config.
+func TestMain_Run_WorkDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := MustWriteTempFile(`
+work_dir = "` + filepath.Join(dir, "config") + `"
+
+[wallpaper]
+enabled     = true
+width       = 10
+height      = 10
+foregrounds = ["#000000"]
+backgrounds = ["#FFFFFF"]
+`)
+	defer os.Remove(path)
+
+	m := main.NewMain()
+	m.Logger = log.New(ioutil.Discard, "", 0)
+	m.Executor = func(name string, args []string, stdin io.Reader) ([]byte, error) { return nil, nil }
+	if err := m.Run([]string{"-once", "-config", path, "-work-dir", filepath.Join(dir, "flag")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "flag", "wallpaper")); err != nil {
+		t.Fatal(err)
+	} else if _, err := os.Stat(filepath.Join(dir, "config")); !os.IsNotExist(err) {
+		t.Fatalf("unexpected config work dir: %v", err)
+	}
+}
+
+// Ensure the effective configuration is printed with defaults filled in.
+func TestMain_Run_PrintConfig(t *testing.T) {
+	path := MustWriteTempFile(`
+[wallpaper]
+enabled     = true
+foregrounds = ["#000000"]
+backgrounds = ["#FFFFFF"]
+`)
+	defer os.Remove(path)
+
+	var buf bytes.Buffer
+	m := main.NewMain()
+	m.Stdout = &buf
+	m.Executor = func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		t.Fatalf("unexpected exec: %s", name)
+		return nil, nil
+	}
+	if err := m.Run([]string{"-config", path, "-print-config", "-work-dir", "/tmp/boxer-flag"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Verify the output decodes to the effective config.
+	config := main.NewConfig()
+	if _, err := toml.Decode(buf.String(), config); err != nil {
+		t.Fatal(err)
+	} else if config.WorkDir != "/tmp/boxer-flag" {
+		t.Fatalf("unexpected work_dir: %s", config.WorkDir)
+	} else if !config.Wallpaper.Enabled {
+		t.Fatal("expected wallpaper enabled")
+	} else if config.TickInterval.Duration != main.DefaultTickInterval {
+		t.Fatalf("unexpected tick_interval: %s", config.TickInterval)
+	}
+
+	// Verify a default field is written for an omitted setting.
+	if !strings.Contains(buf.String(), `interval = "15m0s"`) {
+		t.Fatalf("expected default wallpaper interval:\n%s", buf.String())
+	}
+}
+
+// Ensure the printed sleep threshold matches the one used by the ticker when
+// a command has a minimum tick interval.
+func TestMain_Run_PrintConfig_SleepThreshold(t *testing.T) {
+	path := MustWriteTempFile(`
+[wallpaper]
+enabled           = true
+foregrounds       = ["#000000"]
+backgrounds       = ["#FFFFFF"]
+min_tick_interval = "1m"
+`)
+	defer os.Remove(path)
+
+	var buf bytes.Buffer
+	m := main.NewMain()
+	m.Stdout = &buf
+	if err := m.Run([]string{"-config", path, "-print-config"}); err != nil {
+		t.Fatal(err)
+	}
+
+	config := main.NewConfig()
+	if _, err := toml.Decode(buf.String(), config); err != nil {
+		t.Fatal(err)
+	} else if config.SleepThreshold.Duration != 1*time.Minute+main.DefaultSleepMargin {
+		t.Fatalf("unexpected sleep_threshold: %s", config.SleepThreshold)
+	}
+}
+
+// Ensure the status file is written after a tick.
+func TestMain_Run_StatusFile(t *testing.T) {
+	path := MustWriteTempFile(`
+[[command]]
+name     = "bulbs"
+type     = "exec"
+path     = "bulbs"
+step     = "1m"
+interval = "15m"
+`)
+	defer os.Remove(path)
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	statusPath := filepath.Join(dir, "status.json")
+
+	m := main.NewMain()
+	m.Logger = log.New(ioutil.Discard, "", 0)
+	m.Executor = func(name string, args []string, stdin io.Reader) ([]byte, error) { return nil, nil }
+	m.Clock = &Clock{now: time.Date(2000, time.January, 1, 0, 3, 0, 0, time.UTC)}
+	if err := m.Run([]string{"-once", "-config", path, "-status-file", statusPath}); err != nil {
+		t.Fatal(err)
+	}
+
+	var status main.Status
+	if b, err := ioutil.ReadFile(statusPath); err != nil {
+		t.Fatal(err)
+	} else if err := json.Unmarshal(b, &status); err != nil {
+		t.Fatal(err)
+	} else if len(status.Commands) != 1 {
+		t.Fatalf("unexpected command count: %d", len(status.Commands))
+	} else if c := status.Commands[0]; c.Name != "bulbs" || c.Pct != 0.2 {
+		t.Fatalf("unexpected command status: %+v", c)
+	}
+
+	// Verify no temporary files are left behind.
+	if fis, err := ioutil.ReadDir(dir); err != nil {
+		t.Fatal(err)
+	} else if len(fis) != 1 {
+		t.Fatalf("unexpected file count: %d", len(fis))
+	}
+}
+
+// Ensure a step that doesn't divide evenly into the interval returns an error.
+func TestNewTicker_ErrStepNotMultiple(t *testing.T) {
+	config := main.NewConfig()
+	config.Wallpaper.Enabled = true
+	config.Wallpaper.Step = main.Duration{7 * time.Minute}
+	config.Wallpaper.Interval = main.Duration{15 * time.Minute}
+	config.Wallpaper.Foregrounds = []string{"#000000"}
+	config.Wallpaper.Backgrounds = []string{"#FFFFFF"}
+
+	if _, err := main.NewTicker(config, nil); err == nil || err.Error() != `wallpaper: interval must be a multiple of step: 15m0s / 7m0s` {
+		t.Fatal(err)
+	}
+}
+
+// Ensure log lines are wrapped in JSON log entries.
+func TestJSONLogWriter(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(&main.JSONLogWriter{
+		W:   &buf,
+		Now: func() time.Time { return time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC) },
+	}, "", 0)
+	logger.Printf("Boxer running with %d commands...", 2)
+
+	if buf.String() != `{"ts":"2000-01-01T00:00:00Z","level":"info","msg":"Boxer running with 2 commands..."}`+"\n" {
+		t.Fatalf("unexpected log: %s", buf.String())
+	}
+}
+
+// Ensure messages that are valid JSON but not objects are still wrapped.
+func TestJSONLogWriter_NonObject(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(&main.JSONLogWriter{
+		W:   &buf,
+		Now: func() time.Time { return time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC) },
+	}, "", 0)
+	logger.Print("42")
+
+	if buf.String() != `{"ts":"2000-01-01T00:00:00Z","level":"info","msg":"42"}`+"\n" {
+		t.Fatalf("unexpected log: %s", buf.String())
+	}
+}
+
+// Ensure handler results are logged as JSON with the command name.
+func TestMain_Reload_JSONLog(t *testing.T) {
+	path := MustWriteTempFile("[announcement]\nenabled = true\n")
+	defer os.Remove(path)
+
+	var buf bytes.Buffer
+	m := main.NewMain()
+	m.ConfigPath = path
+	m.LogFormat = "json"
+	m.Logger = log.New(&main.JSONLogWriter{W: &buf, Now: time.Now}, "", 0)
+	m.Executor = func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		return []byte("not allowed"), errors.New("exit status 1")
+	}
+	if err := m.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	m.Ticker().Tick()
+
+	var entry main.LogEntry
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	} else if entry.Level != "error" || entry.Command != "announcement" || entry.Message != "exec display notification: not allowed" {
+		t.Fatalf("unexpected entry: %#v", entry)
+	}
+}
+
+// Ensure handler durations are logged as JSON in verbose mode.
+func TestMain_Reload_JSONLog_Verbose(t *testing.T) {
+	path := MustWriteTempFile("[announcement]\nenabled = true\n")
+	defer os.Remove(path)
+
+	var buf bytes.Buffer
+	m := main.NewMain()
+	m.ConfigPath = path
+	m.LogFormat = "json"
+	m.Verbose = true
+	m.Logger = log.New(&main.JSONLogWriter{W: &buf, Now: time.Now}, "", 0)
+	m.Executor = func(name string, args []string, stdin io.Reader) ([]byte, error) { return nil, nil }
+	if err := m.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	m.Ticker().Tick()
+
+	var found bool
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var entry main.LogEntry
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatal(err)
+		} else if strings.HasPrefix(entry.Message, "command=announcement dur=") {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("expected handler duration entry")
+	}
+}
+
+// Ensure daily summaries & capture errors are logged as JSON.
+func TestMain_Reload_JSONLog_Summary(t *testing.T) {
+	path := MustWriteTempFile(``)
+	defer os.Remove(path)
+
+	var buf bytes.Buffer
+	m := main.NewMain()
+	m.ConfigPath = path
+	m.LogFormat = "json"
+	m.Logger = log.New(&main.JSONLogWriter{W: &buf, Now: time.Now}, "", 0)
+	if err := m.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	ticker := m.Ticker()
+	ticker.Commands = append(ticker.Commands, boxer.Command{
+		Name:     "bulbs",
+		Interval: 1 * time.Hour,
+		Handler:  func(i, n int) error { return nil },
+		Restorable: &Restorable{
+			CaptureFn: func() error { return errors.New("marker") },
+			RestoreFn: func() error { return nil },
+		},
+	})
+	ticker.TickAt(time.Date(2000, time.January, 1, 23, 0, 0, 0, time.UTC))
+	ticker.TickAt(time.Date(2000, time.January, 2, 0, 0, 0, 0, time.UTC))
+
+	msgs := make(map[string]bool)
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var entry main.LogEntry
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatal(err)
+		}
+		msgs[entry.Message] = true
+	}
+	if !msgs["bulbs: capture: marker"] {
+		t.Fatalf("expected capture error: %v", msgs)
+	} else if !msgs["summary: 2000-01-01 bulbs=1"] {
+		t.Fatalf("expected summary: %v", msgs)
+	}
+}
+
+// Ensure shutting down restores state captured by the ticker's handlers.
+func TestMain_Shutdown(t *testing.T) {
+	path := MustWriteTempFile(``)
+	defer os.Remove(path)
+
+	m := main.NewMain()
+	m.ConfigPath = path
+	if err := m.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Add a command that modifies restorable state.
+	var calls []string
+	ticker := m.Ticker()
+	ticker.Commands = append(ticker.Commands, boxer.Command{
+		Interval: 1 * time.Minute,
+		Handler:  func(i, n int) error { return nil },
+		Restorable: &Restorable{
+			CaptureFn: func() error { calls = append(calls, "capture"); return nil },
+			RestoreFn: func() error { calls = append(calls, "restore"); return nil },
+		},
+	})
+	ticker.Tick()
+
+	if err := m.Shutdown(); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(calls, []string{"capture", "restore"}) {
+		t.Fatalf("unexpected calls: %v", calls)
+	}
+}
+
+// Ensure resources are closed even if restoring fails.
+func TestMain_Shutdown_RestoreErr(t *testing.T) {
+	path := MustWriteTempFile(``)
+	defer os.Remove(path)
+
+	m := main.NewMain()
+	m.ConfigPath = path
+	if err := m.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	var closed bool
+	ticker := m.Ticker()
+	ticker.Commands = append(ticker.Commands, boxer.Command{
+		Name:     "wallpaper",
+		Interval: 1 * time.Minute,
+		Handler:  func(i, n int) error { return nil },
+		Restorable: &Restorable{
+			CaptureFn: func() error { return nil },
+			RestoreFn: func() error { return errors.New("marker") },
+		},
+		Closer: &Closer{CloseFn: func() error { closed = true; return errors.New("closed") }},
+	})
+	ticker.Tick()
+
+	if err := m.Shutdown(); err == nil || err.Error() != "restore: marker; close: wallpaper: closed" {
+		t.Fatal(err)
+	} else if !closed {
+		t.Fatal("expected close")
+	}
+}
+
+// Ensure the configured shutdown command is executed once on shutdown.
+func TestMain_Shutdown_Command(t *testing.T) {
+	path := MustWriteTempFile(`
+shutdown_command = "/usr/local/bin/cleanup"
+shutdown_args    = ["--wallpaper"]
+`)
+	defer os.Remove(path)
+
+	var buf bytes.Buffer
+	var calls [][]string
+	m := main.NewMain()
+	m.ConfigPath = path
+	m.Logger = log.New(&buf, "", 0)
+	m.Executor = func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		calls = append(calls, append([]string{name}, args...))
+		return []byte("restored\n"), nil
+	}
+	if err := m.Reload(); err != nil {
+		t.Fatal(err)
+	} else if err := m.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(calls, [][]string{{"/usr/local/bin/cleanup", "--wallpaper"}}) {
+		t.Fatalf("unexpected calls: %v", calls)
+	} else if buf.String() != "shutdown command: restored\n" {
+		t.Fatalf("unexpected log: %s", buf.String())
+	}
+}
+
+// Ensure shutdown command errors are logged.
+func TestMain_Shutdown_CommandErr(t *testing.T) {
+	path := MustWriteTempFile(`shutdown_command = "/usr/local/bin/cleanup"`)
+	defer os.Remove(path)
+
+	var buf bytes.Buffer
+	m := main.NewMain()
+	m.ConfigPath = path
+	m.Logger = log.New(&buf, "", 0)
+	m.Executor = func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		return []byte("not found\n"), errors.New("exit status 127")
+	}
+	if err := m.Reload(); err != nil {
+		t.Fatal(err)
+	} else if err := m.Shutdown(); err != nil {
+		t.Fatal(err)
+	} else if buf.String() != "shutdown command: exit status 127: not found\n" {
+		t.Fatalf("unexpected log: %s", buf.String())
+	}
+}
+
+// Restorable is a mock implementation of boxer.Restorable.
+type Restorable struct {
+	CaptureFn func() error
+	RestoreFn func() error
+}
+
+func (r *Restorable) Capture() error { return r.CaptureFn() }
+func (r *Restorable) Restore() error { return r.RestoreFn() }
+
+// Closer is a mock implementation of io.Closer.
+type Closer struct {
+	CloseFn func() error
+}
+
+func (c *Closer) Close() error { return c.CloseFn() }
+
+// Ensure the run loop can be driven by a mock clock without real time passing.
+func TestMain_Run_Clock(t *testing.T) {
+	path := MustWriteTempFile(``)
+	defer os.Remove(path)
+
+	m := main.NewMain()
+	m.Logger = log.New(ioutil.Discard, "", 0)
+
+	// Advance the clock by the tick interval on every wait and
+	// close the program after ten ticks.
+	var n int
+	clock := &Clock{now: time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)}
+	clock.AfterFn = func(d time.Duration) <-chan time.Time {
+		if n++; n == 10 {
+			m.Close()
+			return nil
+		}
+		clock.now = clock.now.Add(d)
+		ch := make(chan time.Time, 1)
+		ch <- clock.now
+		return ch
+	}
+	m.Clock = clock
+	m.TickInterval = 1 * time.Minute
+
+	if err := m.Run([]string{"-config", path}); err != nil {
+		t.Fatal(err)
+	} else if n != 10 {
+		t.Fatalf("unexpected wait count: %d", n)
+	} else if exp := time.Date(2000, time.January, 1, 0, 9, 0, 0, time.UTC); !clock.now.Equal(exp) {
+		t.Fatalf("unexpected time: %s", clock.now)
+	}
+}
+
+// Clock is a mock implementation of boxer.Clock.
+type Clock struct {
+	now     time.Time
+	AfterFn func(d time.Duration) <-chan time.Time
+}
+
+func (c *Clock) Now() time.Time                         { return c.now }
+func (c *Clock) After(d time.Duration) <-chan time.Time { return c.AfterFn(d) }
+
+// Ensure a built-in theme expands into its wallpaper settings.
+func TestMain_ReadConfig_Theme(t *testing.T) {
+	path := MustWriteTempFile("[wallpaper]\ntheme = \"sunrise\"\n")
+	defer os.Remove(path)
+
+	config, err := main.NewMain().ReadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	theme := main.Themes["sunrise"]
+	if config.Wallpaper.Style != "palette" {
+		t.Fatalf("unexpected style: %s", config.Wallpaper.Style)
+	} else if !reflect.DeepEqual(config.Wallpaper.Foregrounds, theme.Foregrounds) {
+		t.Fatalf("unexpected foregrounds: %v", config.Wallpaper.Foregrounds)
+	} else if !reflect.DeepEqual(config.Wallpaper.Backgrounds, theme.Backgrounds) {
+		t.Fatalf("unexpected backgrounds: %v", config.Wallpaper.Backgrounds)
+	} else if _, err := main.NewWallpaperGenerator(config, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure the rings theme selects the radial style with eased progress.
+func TestMain_ReadConfig_Theme_Rings(t *testing.T) {
+	path := MustWriteTempFile("[wallpaper]\ntheme = \"rings\"\n")
+	defer os.Remove(path)
+
+	config, err := main.NewMain().ReadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	theme := main.Themes["rings"]
+	if config.Wallpaper.Style != "radial" {
+		t.Fatalf("unexpected style: %s", config.Wallpaper.Style)
+	} else if config.Wallpaper.Easing != "ease_out" {
+		t.Fatalf("unexpected easing: %s", config.Wallpaper.Easing)
+	} else if !reflect.DeepEqual(config.Wallpaper.Foregrounds, theme.Foregrounds) {
+		t.Fatalf("unexpected foregrounds: %v", config.Wallpaper.Foregrounds)
+	} else if !reflect.DeepEqual(config.Wallpaper.Backgrounds, theme.Backgrounds) {
+		t.Fatalf("unexpected backgrounds: %v", config.Wallpaper.Backgrounds)
+	} else if _, err := main.NewWallpaperGenerator(config, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure an invalid easing returns an error.
+func TestNewWallpaperGenerator_ErrEasing(t *testing.T) {
+	config := main.NewConfig()
+	config.Wallpaper.Foregrounds = []string{"#000000"}
+	config.Wallpaper.Backgrounds = []string{"#FFFFFF"}
+	config.Wallpaper.Easing = "bounce"
+
+	if _, err := main.NewWallpaperGenerator(config, nil); err == nil || err.Error() != `wallpaper generator: invalid easing: "bounce"` {
+		t.Fatal(err)
+	}
+}
+
+// Ensure an unknown theme returns an error.
+func TestMain_ReadConfig_ErrUnknownTheme(t *testing.T) {
+	path := MustWriteTempFile("[wallpaper]\ntheme = \"rainbow\"\n")
+	defer os.Remove(path)
+
+	if _, err := main.NewMain().ReadConfig(path); err == nil || err.Error() != `unknown theme: "rainbow"` {
+		t.Fatal(err)
+	}
+}
+
+// Ensure the config is read from stdin when the path is "-".
+func TestMain_ReadConfig_Stdin(t *testing.T) {
+	m := main.NewMain()
+	m.Stdin = strings.NewReader(`
+[wallpaper]
+enabled  = true
+step     = "5m"
+interval = "1h"
+`)
+
+	// Read twice to verify the config is reused on reload.
+	for i := 0; i < 2; i++ {
+		config, err := m.ReadConfig("-")
+		if err != nil {
+			t.Fatal(err)
+		} else if !config.Wallpaper.Enabled {
+			t.Fatalf("%d: expected wallpaper enabled", i)
+		} else if config.Wallpaper.Step != (main.Duration{5 * time.Minute}) {
+			t.Fatalf("%d: unexpected wallpaper.step: %v", i, config.Wallpaper.Step)
+		} else if config.Wallpaper.Interval != (main.Duration{1 * time.Hour}) {
+			t.Fatalf("%d: unexpected wallpaper.interval: %v", i, config.Wallpaper.Interval)
+		}
+	}
+}
+
+// Ensure a leading tilde in a config path expands to the home directory.
+func TestMain_ReadConfig_ExpandTilde(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	path := MustWriteTempFile("work_dir = \"~/boxer\"\n")
+	defer os.Remove(path)
+
+	if config, err := main.NewMain().ReadConfig(path); err != nil {
+		t.Fatal(err)
+	} else if exp := filepath.Join(home, "boxer"); config.WorkDir != exp {
+		t.Fatalf("unexpected work dir: %s", config.WorkDir)
+	}
+}
+
+// Ensure environment variables in a config path are expanded.
+func TestMain_ReadConfig_ExpandEnv(t *testing.T) {
+	os.Setenv("BOXER_TEST_DIR", "/tmp/boxer-test")
+	defer os.Unsetenv("BOXER_TEST_DIR")
+
+	path := MustWriteTempFile("work_dir = \"${BOXER_TEST_DIR}/work\"\n[task_file]\npath = \"$BOXER_TEST_DIR/task\"\n")
+	defer os.Remove(path)
+
+	if config, err := main.NewMain().ReadConfig(path); err != nil {
+		t.Fatal(err)
+	} else if config.WorkDir != "/tmp/boxer-test/work" {
+		t.Fatalf("unexpected work dir: %s", config.WorkDir)
+	} else if config.TaskFile.Path != "/tmp/boxer-test/task" {
+		t.Fatalf("unexpected task file path: %s", config.TaskFile.Path)
+	}
+}
+
+// Ensure the BOXER_CONFIG environment variable overrides the default config path.
+func TestDefaultConfigPath_Env(t *testing.T) {
+	defer os.Setenv("BOXER_CONFIG", os.Getenv("BOXER_CONFIG"))
+	os.Setenv("BOXER_CONFIG", "/tmp/custom.conf")
+
+	if path, err := main.DefaultConfigPath(); err != nil {
+		t.Fatal(err)
+	} else if path != "/tmp/custom.conf" {
+		t.Fatalf("unexpected path: %s", path)
+	}
+}
+
+// Ensure the XDG config path is used when it exists.
+func TestDefaultConfigPath_XDG(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer os.Setenv("BOXER_CONFIG", os.Getenv("BOXER_CONFIG"))
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	os.Setenv("BOXER_CONFIG", "")
+	os.Setenv("XDG_CONFIG_HOME", dir)
+
+	// Missing files should fall back to the XDG path.
+	exp := filepath.Join(dir, "boxer", "boxer.conf")
+	if path, err := main.DefaultConfigPath(); err != nil {
+		t.Fatal(err)
+	} else if path != exp {
+		t.Fatalf("unexpected path: %s", path)
+	}
+
+	// Existing XDG file should be returned.
+	if err := os.MkdirAll(filepath.Dir(exp), 0777); err != nil {
+		t.Fatal(err)
+	} else if err := ioutil.WriteFile(exp, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if path, err := main.DefaultConfigPath(); err != nil {
+		t.Fatal(err)
+	} else if path != exp {
+		t.Fatalf("unexpected path: %s", path)
+	}
+}
+
+// Ensure metrics are served in the Prometheus text format.
+func TestMetrics_ServeHTTP(t *testing.T) {
+	m := main.NewMetrics()
+	m.IncTicks()
+	m.IncTicks()
+	m.IncIntervals("wallpaper")
+	m.IncIntervals("menu_bar")
+	m.IncIntervals("wallpaper")
+	m.IncErrors("menu_bar")
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if body := w.Body.String(); body != `# HELP boxer_ticks_total Number of ticks executed.
+# TYPE boxer_ticks_total counter
+boxer_ticks_total 2
+# HELP boxer_intervals_completed_total Number of intervals completed per command.
+# TYPE boxer_intervals_completed_total counter
+boxer_intervals_completed_total{command="menu_bar"} 1
+boxer_intervals_completed_total{command="wallpaper"} 2
+# HELP boxer_handler_errors_total Number of handler errors per command.
+# TYPE boxer_handler_errors_total counter
+boxer_handler_errors_total{command="menu_bar"} 1
+` {
+		t.Fatalf("unexpected body:\n%s", body)
+	}
+}
+
+// Ensure the status is broadcast to WebSocket clients after each tick.
+func TestMain_Run_StatusStream(t *testing.T) {
+	path := MustWriteTempFile(`
+[[command]]
+name     = "bulbs"
+type     = "exec"
+path     = "bulbs"
+step     = "1m"
+interval = "15m"
+`)
+	defer os.Remove(path)
+
+	// Find a free address for the server.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	m := main.NewMain()
+	m.Logger = log.New(ioutil.Discard, "", 0)
+	m.Executor = func(name string, args []string, stdin io.Reader) ([]byte, error) { return nil, nil }
+
+	// Connect after the first tick and read the frame sent by the second.
+	var n int
+	var conn net.Conn
+	var r *bufio.Reader
+	var status main.Status
+	clock := &Clock{now: time.Date(2000, time.January, 1, 0, 3, 0, 0, time.UTC)}
+	clock.AfterFn = func(d time.Duration) <-chan time.Time {
+		switch n++; n {
+		case 1:
+			if conn, r, err = DialWebSocket(addr, "/ws"); err != nil {
+				t.Error(err)
+				m.Close()
+				return nil
+			}
+		case 2:
+			if b, err := ReadWebSocketFrame(r); err != nil {
+				t.Error(err)
+			} else if err := json.Unmarshal(b, &status); err != nil {
+				t.Error(err)
+			}
+			m.Close()
+			return nil
+		}
+		clock.now = clock.now.Add(time.Minute)
+		ch := make(chan time.Time, 1)
+		ch <- clock.now
+		return ch
+	}
+	m.Clock = clock
+	m.TickInterval = 1 * time.Minute
+
+	if err := m.Run([]string{"-config", path, "-metrics-addr", addr}); err != nil {
+		t.Fatal(err)
+	}
+	if conn != nil {
+		conn.Close()
+	}
+	if t.Failed() {
+		return
+	}
+
+	if !status.Time.Equal(time.Date(2000, time.January, 1, 0, 4, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected time: %s", status.Time)
+	} else if len(status.Commands) != 1 {
+		t.Fatalf("unexpected command count: %d", len(status.Commands))
+	} else if c := status.Commands[0]; c.Name != "bulbs" || c.I != 4 {
+		t.Fatalf("unexpected command status: %+v", c)
+	}
+}
+
+// DialWebSocket connects to a WebSocket endpoint and completes the handshake.
+func DialWebSocket(addr, path string) (net.Conn, *bufio.Reader, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n", path, addr)
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	} else if resp.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return nil, nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	} else if v := resp.Header.Get("Sec-WebSocket-Accept"); v != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		conn.Close()
+		return nil, nil, fmt.Errorf("unexpected accept: %s", v)
+	}
+	return conn, r, nil
+}
+
+// ReadWebSocketFrame reads the payload of a single unmasked text frame.
+func ReadWebSocketFrame(r *bufio.Reader) ([]byte, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	} else if hdr[0] != 0x81 {
+		return nil, fmt.Errorf("unexpected frame header: %x", hdr[0])
+	}
+
+	n := int(hdr[1] & 0x7F)
+	if n == 126 {
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return nil, err
+		}
+		n = int(ext[0])<<8 | int(ext[1])
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Ensure tick & handler spans are exported to the collector in the OTLP format
+// with each handler span parented to the span of its own tick.
+func TestOTLPTracer(t *testing.T) {
+	var paths []string
+	var req struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []struct {
+					Key   string
+					Value map[string]interface{}
+				}
+			}
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceID      string
+					SpanID       string
+					ParentSpanID string
+					Name         string
+					Attributes   []struct {
+						Key   string
+						Value map[string]interface{}
+					}
+					Status struct {
+						Code    int
+						Message string
+					}
+				}
+			}
+		}
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+	}))
+	defer srv.Close()
+
+	tracer := main.NewOTLPTracer(srv.URL)
+	ticker := boxer.NewTicker()
+	ticker.Tracer = tracer
+	ticker.Logger = log.New(ioutil.Discard, "", 0)
+	now := time.Date(2000, time.January, 1, 0, 3, 0, 0, time.UTC)
+	ticker.Now = func() time.Time { return now }
+	ticker.Commands = append(ticker.Commands, boxer.Command{
+		Name:     "wallpaper",
+		Step:     1 * time.Minute,
+		Interval: 4 * time.Minute,
+		Handler:  func(i, n int) error { return errors.New("marker") },
+	})
+	ticker.Tick()
+	now = now.Add(1 * time.Minute)
+	ticker.Tick()
+	if err := tracer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(paths, []string{"/v1/traces"}) {
+		t.Fatalf("unexpected paths: %v", paths)
+	} else if len(req.ResourceSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("unexpected request: %#v", req)
+	} else if attrs := req.ResourceSpans[0].Resource.Attributes; len(attrs) != 1 || attrs[0].Key != "service.name" || attrs[0].Value["stringValue"] != "boxer" {
+		t.Fatalf("unexpected resource attributes: %#v", attrs)
+	}
+
+	// Verify each handler span is a child of its own tick span.
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 4 {
+		t.Fatalf("unexpected span count: %d", len(spans))
+	}
+	for i := 0; i < len(spans); i += 2 {
+		if h, tick := spans[i], spans[i+1]; h.Name != "handler" || tick.Name != "tick" {
+			t.Fatalf("unexpected span names: %s, %s", h.Name, tick.Name)
+		} else if h.TraceID != tick.TraceID || h.ParentSpanID != tick.SpanID || tick.ParentSpanID != "" {
+			t.Fatalf("unexpected span ids: %#v", spans)
+		} else if h.Status.Code != 2 || h.Status.Message != "marker" {
+			t.Fatalf("unexpected handler status: %#v", h.Status)
+		} else if tick.Status.Code != 1 {
+			t.Fatalf("unexpected tick status: %#v", tick.Status)
+		}
+	}
+	if spans[0].TraceID == spans[2].TraceID || spans[0].ParentSpanID == spans[2].ParentSpanID {
+		t.Fatalf("expected separate traces per tick: %#v", spans)
+	}
+
+	attrs := make(map[string]interface{})
+	for _, kv := range spans[0].Attributes {
+		for _, v := range kv.Value {
+			attrs[kv.Key] = v
+		}
+	}
+	if !reflect.DeepEqual(attrs, map[string]interface{}{"command": "wallpaper", "step": "3", "total": "4", "pct": 0.75}) {
+		t.Fatalf("unexpected handler attributes: %#v", attrs)
+	}
+}
+
+// Ensure spans are exported to the configured otel endpoint on shutdown.
+func TestMain_Reload_OTel(t *testing.T) {
+	var n int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { n++ }))
+	defer srv.Close()
+
+	path := MustWriteTempFile("[otel]\nendpoint = \"" + srv.URL + "\"\n")
+	defer os.Remove(path)
+
+	m := main.NewMain()
+	m.ConfigPath = path
+	if err := m.Reload(); err != nil {
+		t.Fatal(err)
+	} else if m.Ticker().Tracer == nil {
+		t.Fatal("expected tracer")
+	}
+
+	m.Ticker().Tick()
+	if err := m.Shutdown(); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("unexpected export count: %d", n)
+	}
+}
+
+// Ensure user-defined exec commands are built from the config.
+func TestNewTicker_ExecCommand(t *testing.T) {
+	config := main.NewConfig()
+	if _, err := toml.Decode(`
+[[command]]
+name     = "bulbs"
+type     = "exec"
+path     = "/usr/local/bin/bulbs"
+args     = ["--brightness", "{pct}"]
+step     = "1m"
+interval = "10m"
+`, config); err != nil {
+		t.Fatal(err)
+	}
+
+	var args []string
+	ticker, err := main.NewTicker(config, func(name string, a []string, stdin io.Reader) ([]byte, error) {
+		args = append([]string{name}, a...)
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd, ok := ticker.Command("bulbs")
+	if !ok {
+		t.Fatal("expected command")
+	} else if cmd.Step != 1*time.Minute || cmd.Interval != 10*time.Minute {
+		t.Fatalf("unexpected step/interval: %s/%s", cmd.Step, cmd.Interval)
+	} else if err := cmd.Handler(5, 10); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(args, []string{"/usr/local/bin/bulbs", "--brightness", "0.5"}) {
+		t.Fatalf("unexpected args: %v", args)
+	}
+}
+
+// Ensure an unknown user-defined command type returns an error.
+// Ensure visual commands are skipped while the system is idle past the
+// threshold and that the idle time is only queried once per tick.
+func TestNewTicker_IdleThreshold(t *testing.T) {
+	var calls []string
+	exec := func(name string, args []string, stdin io.Reader) ([]byte, error) {
+		calls = append(calls, name)
+		if name == boxer.IORegPath {
+			return []byte(`"HIDIdleTime" = 3600000000000`), nil
+		}
+		return nil, nil
+	}
+
+	config := main.NewConfig()
+	config.IdleThreshold = main.Duration{5 * time.Minute}
+	config.MenuBar.Enabled = true
+	config.Announcement.Enabled = true
+	config.Commands = []main.CommandConfig{
+		{Name: "bulbs", Type: "exec", Path: "/usr/local/bin/bulbs", Interval: main.Duration{15 * time.Minute}},
+	}
+
+	ticker, err := main.NewTicker(config, exec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticker.Logger = log.New(ioutil.Discard, "", 0)
+	ticker.Now = func() time.Time { return time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC) }
+	if errs := ticker.Tick(); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	// Verify the user command ran & the gated commands shared one query.
+	if !reflect.DeepEqual(calls, []string{boxer.IORegPath, "/usr/local/bin/bulbs"}) {
+		t.Fatalf("unexpected calls: %v", calls)
+	}
+}
+
+// Ensure an unknown user-defined command type returns an error.
+func TestNewTicker_ErrUnknownCommandType(t *testing.T) {
+	config := main.NewConfig()
+	config.Commands = []main.CommandConfig{{Name: "bulbs", Type: "http"}}
+	if _, err := main.NewTicker(config, nil); err == nil || err.Error() != `bulbs: unknown command type: "http"` {
+		t.Fatal(err)
+	}
+}